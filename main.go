@@ -13,6 +13,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"net/http"
@@ -37,6 +38,13 @@ var (
 	date    = "2023-09-03T17:54:45Z"
 )
 
+const (
+	// checkConfigCommand validates the configuration file and exits
+	checkConfigCommand = "check-config"
+	// schemaCommand prints the JSON Schema of the configuration file and exits
+	schemaCommand = "schema"
+)
+
 type buildInfo struct {
 	App       string
 	Version   string
@@ -58,6 +66,20 @@ func closeHandler() {
 	}()
 }
 
+// reloadHandler reloads the configuration when the process receives SIGHUP
+func reloadHandler(reloader *pkg.Reloader) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	go func() {
+		for range c {
+			slog.Info("Reloading configuration", "signal", "SIGHUP")
+			if err := reloader.Reload(); err != nil {
+				slog.Error("Error reloading configuration, keeping previous configuration", "error", err)
+			}
+		}
+	}()
+}
+
 // getbuildInfo constructs and returns a buildInfo struct containing metadata
 // about the application build, such as the application name, version, build date,
 // platform, commit hash, and Go runtime version. The build date is parsed and
@@ -83,6 +105,69 @@ func printVersion() {
 	fmt.Println(awsutil.Prettify(appversion))
 }
 
+// usage prints the commands and flags of the program
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage: %s [command] [flags]
+
+Commands:
+  %s	Validate the configuration file and exit
+  %s		Print the JSON Schema of the configuration file and exit
+
+Flags:
+`, os.Args[0], checkConfigCommand, schemaCommand)
+	flag.PrintDefaults()
+}
+
+// checkConfig validates configFile, prints every problem found and returns the process exit code
+func checkConfig(configFile string) int {
+	qcl, err := pkg.NewQuotaConfig(configFile)
+	if err != nil {
+		var errs pkg.ConfigErrors
+		if errors.As(err, &errs) {
+			fmt.Fprintf(os.Stderr, "%s: %d problem(s) found\n", configFile, len(errs))
+			for _, e := range errs {
+				file := e.File
+				if file == "" {
+					file = configFile
+				}
+				fmt.Fprintf(os.Stderr, "  %s:%d: %s\n", file, e.Line, e.Msg)
+			}
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "%s: %s\n", configFile, err)
+		return 1
+	}
+	fmt.Printf("%s: configuration is valid (%d jobs)\n", configFile, len(qcl.Jobs))
+	return 0
+}
+
+// printSchema prints the JSON Schema of the configuration file and returns the process exit code
+func printSchema() int {
+	schema, err := pkg.Schema()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating schema: %s\n", err)
+		return 1
+	}
+	fmt.Println(string(schema))
+	return 0
+}
+
+// printEffectiveConfig prints the jobs resolved from configFile and returns the process exit code
+func printEffectiveConfig(configFile string) int {
+	qcl, err := pkg.NewQuotaConfig(configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing '%s': %s\n", configFile, err)
+		return 1
+	}
+	effective, err := qcl.Effective()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error printing '%s': %s\n", configFile, err)
+		return 1
+	}
+	fmt.Print(effective)
+	return 0
+}
+
 // buildInfoMetrics generates a slice of Prometheus metrics containing build information
 // about the application. It retrieves build details such as the application name, version,
 // build date, platform, commit hash, and Go version, and packages them into a Prometheus
@@ -116,22 +201,52 @@ func buildInfoMetrics() ([]*pkg.PrometheusMetric, error) {
 
 func main() {
 	var (
-		configFile      = flag.String("config.file", "/etc/aqe/config.yml", "Path to configuration file.")
-		logFormatType   = flag.String("log.format", "text", "Format of log messages (text or json).")
-		logFolder       = flag.String("log.folder", "stdout", "Folder to store logfiles. logs to stdout if not specified.")
-		logLevel        = flag.String("log.level", "INFO", "Log level to log from (DEBUG|INFO|WARN|ERROR).")
-		promPort        = flag.Int("prom.port", 10100, "Port to expose prometheus metrics.")
-		cacheDuration   = flag.Duration("cache.duration", 300*time.Second, "Cache expiry time.")
-		cacheServeStale = flag.Bool("cache.serve-stale", false, "Serve stale cache data during cache refresh. This avoids delays in serving metrics. (default: false)")
-		collectUsage    = flag.Bool("collect.usage", false, "Collect quotas usage where available (NOTE: CloudWatch calls aren't free, default: false)")
-		Version         = flag.Bool("version", false, "Display aqe version")
+		configFile           = flag.String("config.file", "/etc/aqe/config.yml", "Path to configuration file, directory of *.yml files, glob pattern or https:// or s3:// URL.")
+		configPrintEffective = flag.Bool("config.print-effective", false, "Print the jobs resolved from the configuration file (with defaults applied) and exit.")
+		configWatchInterval  = flag.Duration("config.watch-interval", 0, "Interval to check the configuration file for changes and reload it. Disabled when 0, except for URLs fetched every 5m by default. (default: 0)")
+		logFormatType        = flag.String("log.format", "text", "Format of log messages (text or json).")
+		logFolder            = flag.String("log.folder", "stdout", "Folder to store logfiles. logs to stdout if not specified.")
+		logLevel             = flag.String("log.level", "INFO", "Log level to log from (DEBUG|INFO|WARN|ERROR).")
+		promPort             = flag.Int("prom.port", 10100, "Port to expose prometheus metrics.")
+		cacheDuration        = flag.Duration("cache.duration", 300*time.Second, "Cache expiry time.")
+		cacheServeStale      = flag.Bool("cache.serve-stale", false, "Serve stale cache data during cache refresh. This avoids delays in serving metrics. (default: false)")
+		discoveryInterval    = flag.Duration("discovery.interval", pkg.DefaultDiscoveryInterval, "Interval to refresh the regions and services discovered by jobs.")
+		collectUsage         = flag.Bool("collect.usage", false, "Collect quotas usage where available (NOTE: CloudWatch calls aren't free, default: false)")
+		collectRequests      = flag.Bool("collect.requests", false, "Collect quota increase requests (ListRequestedServiceQuotaChangeHistory). (default: false)")
+		awsRateLimit         = flag.Float64("aws.rate-limit", 0, "Calls per second of every AWS API per account (token bucket). Disabled when 0. (default: 0)")
+		awsBurst             = flag.Int("aws.burst", 1, "Size of the token bucket of -aws.rate-limit: calls of every AWS API per account allowed at once.")
+		awsMaxConcurrency    = flag.Int("aws.max-concurrency", 0, "Calls in flight of every AWS API per account. Unlimited when 0. (default: 0)")
+		awsRetryMode         = flag.String("aws.retry-mode", "", "Retry mode of the AWS API calls (standard or adaptive), AWS_RETRY_MODE or the profile by default.")
+		awsMaxAttempts       = flag.Int("aws.max-attempts", 0, "Attempts of an AWS API call, including the first one, AWS_MAX_ATTEMPTS or the profile by default.")
+		Version              = flag.Bool("version", false, "Display aqe version")
 	)
+	flag.Usage = usage
 	flag.Parse()
+	// flags are also accepted after the command
+	command := flag.Arg(0)
+	if command != "" {
+		_ = flag.CommandLine.Parse(flag.Args()[1:])
+	}
+
+	switch command {
+	case "":
+	case checkConfigCommand:
+		os.Exit(checkConfig(*configFile))
+	case schemaCommand:
+		os.Exit(printSchema())
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n", command)
+		flag.Usage()
+		os.Exit(2)
+	}
 
 	if *Version {
 		printVersion()
 		os.Exit(0)
 	}
+	if *configPrintEffective {
+		os.Exit(printEffectiveConfig(*configFile))
+	}
 	// create logger
 	logger := pkg.NewLogger(*logFormatType, *logFolder, *logLevel).With("version", version)
 	slog.SetDefault(logger)
@@ -141,36 +256,65 @@ func main() {
 	// Handle keyboard interrupt
 	closeHandler()
 
-	// Make Prometheus client aware of our collectors.
-	qcl, err := pkg.NewQuotaConfig(*configFile)
-	if err != nil {
-		slog.Error(fmt.Sprintf("Error parsing '%s'", *configFile), "error", err)
-		return
-	}
-	s, err := pkg.NewScraper()
+	s, err := pkg.NewScraper(
+		pkg.WithDiscoveryInterval(*discoveryInterval),
+		pkg.WithCollectRequests(*collectRequests),
+		pkg.WithAPILimits(pkg.APILimits{
+			Rate:           *awsRateLimit,
+			Burst:          *awsBurst,
+			MaxConcurrency: *awsMaxConcurrency,
+			RetryMode:      *awsRetryMode,
+			MaxAttempts:    *awsMaxAttempts,
+		}),
+	)
 	if err != nil {
 		slog.Error("Error creating scraper", "error", err)
 		return
 	}
 
-	reg := prometheus.NewRegistry()
+	// Make Prometheus client aware of our collectors.
+	newCollector := func(job pkg.JobConfig) prometheus.Collector {
+		return s.CreateCollector(job, cacheDuration, *cacheServeStale, *collectUsage)
+	}
+	static := append(pkg.SelfCollectors(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		pkg.NewPrometheusCollector(buildInfoMetrics),
+	)
+	reloader := pkg.NewReloader(*configFile, newCollector, static...)
 	slog.Info("Registering scrappers")
-	for _, job := range qcl.Jobs {
-
-		pc := pkg.NewPrometheusCollector(s.CreateScraper(job, cacheDuration, *cacheServeStale, *collectUsage))
-		err = reg.Register(pc)
-		if err != nil {
-			slog.Error("Failed to register metrics: "+err.Error(), "serviceCode", job.ServiceCode, "regions", job.Regions, "role", job.Role)
-		}
+	if err := reloader.Reload(); err != nil {
+		slog.Error(fmt.Sprintf("Error parsing '%s'", *configFile), "error", err)
+		return
 	}
 
-	reg.Register(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
-	reg.Register(pkg.NewPrometheusCollector(buildInfoMetrics))
+	// Handle configuration reloads
+	reloadHandler(reloader)
+	watchInterval := *configWatchInterval
+	if watchInterval == 0 && pkg.IsRemoteConfig(*configFile) {
+		watchInterval = pkg.DefaultRemoteConfigInterval
+	}
+	if watchInterval > 0 {
+		go reloader.Watch(watchInterval)
+	}
 
 	mux := http.NewServeMux()
-	promHandler := promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+	promHandler := promhttp.HandlerFor(reloader, promhttp.HandlerOpts{})
 	mux.Handle("/metrics", promHandler)
 
+	mux.HandleFunc("/-/reload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Only POST requests allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := reloader.Reload(); err != nil {
+			slog.Error("Error reloading configuration, keeping previous configuration", "file", *configFile, "error", err)
+			http.Error(w, fmt.Sprintf("failed to reload config: %s", err), http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	})
+
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		_, _ = w.Write([]byte(fmt.Sprintf(`<html>
     <head><title>AWS Quota Exporter</title></head>
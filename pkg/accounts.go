@@ -0,0 +1,236 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	"golang.org/x/exp/slog"
+)
+
+// AccountConfig is an account scraped by a job
+type AccountConfig struct {
+	ID   string `yaml:"id" description:"Account id, {{.AccountID}} in the role template." title:"account id" pattern:"^[0-9]{12}$"`
+	Name string `yaml:"name,omitempty" description:"Account name, {{.AccountName}} in the role template and the account_name label."`
+}
+
+// roleTemplateData is available in role templates, e.g. arn:aws:iam::{{.AccountID}}:role/quota-reader
+type roleTemplateData struct {
+	AccountID   string
+	AccountName string
+}
+
+// isRoleTemplate returns true if role contains template actions
+func isRoleTemplate(role string) bool {
+	return strings.Contains(role, "{{")
+}
+
+// renderRole renders the role template of a job for account
+func renderRole(role string, account AccountConfig) (string, error) {
+	if !isRoleTemplate(role) {
+		return role, nil
+	}
+	tmpl, err := template.New("role").Option("missingkey=error").Parse(role)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, roleTemplateData{AccountID: account.ID, AccountName: account.Name}); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// accountScraper holds the credentials, regions and caches of one account of a job
+type accountScraper struct {
+	cfg         aws.Config
+	role        string
+	accountID   string
+	accountName string
+	regions     *regionResolver
+	caches      *cacheStores
+}
+
+// newAccountScrapers creates an accountScraper for every account of job.
+// Jobs without accounts scrape the account of their role (or of the default credentials).
+func (s *Scraper) newAccountScrapers(job JobConfig, cacheDuration time.Duration) ([]*accountScraper, error) {
+	if len(job.Accounts) == 0 {
+		cfg, err := s.getAWSConfig(job, job.Role)
+		if err != nil {
+			return nil, err
+		}
+		a, err := s.newAccountScraper(job, cfg, job.Role, getAWSAccountID(cfg, job.Endpoints), job.AccountName, cacheDuration)
+		if err != nil {
+			return nil, err
+		}
+		return []*accountScraper{a}, nil
+	}
+
+	accounts := []*accountScraper{}
+	for _, account := range job.Accounts {
+		role, err := renderRole(job.Role, account)
+		if err != nil {
+			return nil, err
+		}
+		name := account.Name
+		if name == "" {
+			name = job.AccountName
+		}
+		cfg, err := s.getAWSConfig(job, role)
+		if err != nil {
+			return nil, err
+		}
+		a, err := s.newAccountScraper(job, cfg, role, account.ID, name, cacheDuration)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, a)
+	}
+	return accounts, nil
+}
+
+func (s *Scraper) newAccountScraper(job JobConfig, cfg aws.Config, role, accountID, accountName string, cacheDuration time.Duration) (*accountScraper, error) {
+	regions, err := newRegionResolver(job, s.discoveryInterval)
+	if err != nil {
+		return nil, err
+	}
+	a := &accountScraper{
+		cfg:         s.limiter.withAPILimits(cfg, accountID),
+		role:        role,
+		accountID:   accountID,
+		accountName: accountName,
+		regions:     regions,
+		caches:      newCacheStores(cacheDuration, accountID),
+	}
+	// resolve discovered regions at startup, they are refreshed during scrapes
+	if a.regions.isDynamic() {
+		if _, err := a.regions.Regions(context.Background(), a.cfg); err != nil {
+			slog.Warn("Failed to discover regions", "serviceCode", job.ServiceCode, "account", accountID, "error", err)
+		}
+	}
+	return a, nil
+}
+
+// accountResolver resolves the accounts of a job.
+// Static accounts are created once, the accounts of an organization are listed
+// and refreshed every interval, keeping the scrapers (and caches) of known accounts.
+type accountResolver struct {
+	discoveryCache[organizationAccount]
+	scraper       *Scraper
+	job           JobConfig
+	cacheDuration time.Duration
+	static        []*accountScraper
+	orgCfg        aws.Config
+	newClient     func(cfg aws.Config) OrganizationsClient
+	mutex         *sync.Mutex
+	discovered    map[string]*accountScraper
+}
+
+func (s *Scraper) newAccountResolver(job JobConfig, cacheDuration time.Duration) (*accountResolver, error) {
+	r := &accountResolver{
+		discoveryCache: newDiscoveryCache[organizationAccount](s.discoveryInterval),
+		scraper:        s,
+		job:            job,
+		cacheDuration:  cacheDuration,
+		newClient: func(cfg aws.Config) OrganizationsClient {
+			return organizations.NewFromConfig(cfg)
+		},
+		mutex:      new(sync.Mutex),
+		discovered: map[string]*accountScraper{},
+	}
+	if job.Organization == nil {
+		accounts, err := s.newAccountScrapers(job, cacheDuration)
+		r.static = accounts
+		return r, err
+	}
+	cfg, err := s.getAWSConfig(job, job.Organization.Role)
+	if err != nil {
+		return r, err
+	}
+	r.orgCfg = cfg
+	// resolve the accounts at startup, they are refreshed during scrapes
+	if _, err := r.Accounts(context.Background()); err != nil {
+		slog.Warn("Failed to discover organization accounts", "serviceCode", job.ServiceCode, "error", err)
+	}
+	return r, nil
+}
+
+// isDynamic returns true when accounts are discovered from the organization
+func (r *accountResolver) isDynamic() bool {
+	return r.job.Organization != nil
+}
+
+// Accounts returns the accounts scraped by the job
+func (r *accountResolver) Accounts(ctx context.Context) ([]*accountScraper, error) {
+	if !r.isDynamic() {
+		return r.static, nil
+	}
+	discovered, err := r.get(func() ([]organizationAccount, error) {
+		return listOrganizationAccounts(ctx, r.newClient(r.orgCfg), r.orgCfg.Region, *r.job.Organization, r.job.Role)
+	}, ErrNoAccounts)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	accounts := make([]*accountScraper, 0, len(discovered))
+	current := make(map[string]*accountScraper, len(discovered))
+	for _, account := range discovered {
+		a, ok := r.discovered[account.ID]
+		if !ok || a.role != account.role {
+			name := account.Name
+			if name == "" {
+				name = r.job.AccountName
+			}
+			cfg, err := r.scraper.getAWSConfig(r.job, account.role)
+			if err != nil {
+				slog.Warn("Skipping organization account", "serviceCode", r.job.ServiceCode, "account", account.ID, "error", err)
+				continue
+			}
+			if a, err = r.scraper.newAccountScraper(r.job, cfg, account.role, account.ID, name, r.cacheDuration); err != nil {
+				slog.Warn("Skipping organization account", "serviceCode", r.job.ServiceCode, "account", account.ID, "error", err)
+				continue
+			}
+			slog.Info("Organization account added", "serviceCode", r.job.ServiceCode, "account", account.ID, "accountName", name)
+		}
+		current[account.ID] = a
+		accounts = append(accounts, a)
+	}
+	for id, a := range r.discovered {
+		if current[id] != a {
+			// removed, or replaced because its role changed
+			a.caches.remove()
+		}
+		if _, ok := current[id]; !ok {
+			slog.Info("Organization account removed", "serviceCode", r.job.ServiceCode, "account", id)
+		}
+	}
+	r.discovered = current
+	return accounts, nil
+}
+
+// close deletes the cache files of every account, the job is not scraped anymore
+func (r *accountResolver) close() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, a := range r.static {
+		a.caches.remove()
+	}
+	for _, a := range r.discovered {
+		a.caches.remove()
+	}
+}
+
+// discoveryConfig returns the configuration used to discover the services of the job
+func (r *accountResolver) discoveryConfig() aws.Config {
+	if r.isDynamic() || len(r.static) == 0 {
+		return r.orgCfg
+	}
+	return r.static[0].cfg
+}
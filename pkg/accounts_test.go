@@ -0,0 +1,99 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+func Test_renderRole(t *testing.T) {
+	tests := []struct {
+		name    string
+		role    string
+		account AccountConfig
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "plain role",
+			role:    "arn:aws:iam::012345678901:role/quota-reader",
+			account: AccountConfig{ID: "111111111111"},
+			want:    "arn:aws:iam::012345678901:role/quota-reader",
+		},
+		{
+			name:    "account id template",
+			role:    "arn:aws:iam::{{.AccountID}}:role/quota-reader",
+			account: AccountConfig{ID: "111111111111", Name: "dev"},
+			want:    "arn:aws:iam::111111111111:role/quota-reader",
+		},
+		{
+			name:    "account name template",
+			role:    "arn:aws:iam::{{.AccountID}}:role/{{.AccountName}}-quota-reader",
+			account: AccountConfig{ID: "111111111111", Name: "dev"},
+			want:    "arn:aws:iam::111111111111:role/dev-quota-reader",
+		},
+		{
+			name:    "unknown field",
+			role:    "arn:aws:iam::{{.ID}}:role/quota-reader",
+			account: AccountConfig{ID: "111111111111"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid template",
+			role:    "arn:aws:iam::{{.AccountID:role/quota-reader",
+			account: AccountConfig{ID: "111111111111"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderRole(tt.role, tt.account)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("renderRole() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("renderRole() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScraper_newAccountScrapers(t *testing.T) {
+	cfg, _ := config.LoadDefaultConfig(context.TODO())
+	s := &Scraper{cfg: cfg, discoveryInterval: time.Hour}
+	job := JobConfig{
+		ServiceCode: "lambda",
+		Regions:     []string{"us-west-2"},
+		Role:        "arn:aws:iam::{{.AccountID}}:role/quota-reader",
+		AccountName: "default-name",
+		Accounts: []AccountConfig{
+			{ID: "111111111111", Name: "dev"},
+			{ID: "222222222222"},
+		},
+	}
+	accounts, err := s.newAccountScrapers(job, time.Minute)
+	if err != nil {
+		t.Fatalf("newAccountScrapers() error = %v", err)
+	}
+	want := []struct{ id, name, role string }{
+		{"111111111111", "dev", "arn:aws:iam::111111111111:role/quota-reader"},
+		{"222222222222", "default-name", "arn:aws:iam::222222222222:role/quota-reader"},
+	}
+	if len(accounts) != len(want) {
+		t.Fatalf("newAccountScrapers() returned %d accounts, want %d", len(accounts), len(want))
+	}
+	for i, w := range want {
+		a := accounts[i]
+		if a.accountID != w.id || a.accountName != w.name || a.role != w.role {
+			t.Errorf("account %d = (%s, %s, %s), want (%s, %s, %s)", i, a.accountID, a.accountName, a.role, w.id, w.name, w.role)
+		}
+		if a.cfg.Credentials == cfg.Credentials {
+			t.Errorf("account %d expected its own credentials", i)
+		}
+	}
+	if accounts[0].caches == accounts[1].caches {
+		t.Error("expected a cache per account")
+	}
+}
@@ -3,8 +3,12 @@ package pkg
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
+	"sync"
 	"time"
+
+	"golang.org/x/exp/slog"
 )
 
 // Cache struct to manage the cache
@@ -83,3 +87,57 @@ func (c *Cache) Write(data []*PrometheusMetric) error {
 	}
 	return err
 }
+
+// Remove deletes the cache file, the cache is not used anymore
+func (c *Cache) Remove() error {
+	c.isEmpty = true
+	return os.Remove(c.FileName)
+}
+
+// cacheStores creates and keeps one Cache per service
+type cacheStores struct {
+	mutex     *sync.Mutex
+	lifeTime  time.Duration
+	accountID string
+	stores    map[string]*Cache
+}
+
+func newCacheStores(lifeTime time.Duration, accountID string) *cacheStores {
+	return &cacheStores{
+		mutex:     new(sync.Mutex),
+		lifeTime:  lifeTime,
+		accountID: accountID,
+		stores:    map[string]*Cache{},
+	}
+}
+
+// get returns the Cache of serviceCode, creating it on first use. nil is returned if the cache is disabled.
+func (c *cacheStores) get(serviceCode string) *Cache {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if store, ok := c.stores[serviceCode]; ok {
+		return store
+	}
+	store, err := NewCache(serviceCode, c.lifeTime)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Cache disabled for %s (account %s)", serviceCode, c.accountID))
+		store = nil
+	}
+	c.stores[serviceCode] = store
+	return store
+}
+
+// remove deletes the cache files of every service
+func (c *cacheStores) remove() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for serviceCode, store := range c.stores {
+		if store == nil {
+			continue
+		}
+		if err := store.Remove(); err != nil && !os.IsNotExist(err) {
+			slog.Warn("Failed to remove cache file", "file", store.FileName, "error", err)
+		}
+		delete(c.stores, serviceCode)
+	}
+}
@@ -1,6 +1,7 @@
 package pkg
 
 import (
+	"os"
 	"strings"
 	"testing"
 	"time"
@@ -49,6 +50,24 @@ func TestNewCache(t *testing.T) {
 	}
 }
 
+func Test_cacheStores_remove(t *testing.T) {
+	stores := newCacheStores(time.Minute, "111111111111")
+	cache := stores.get("ec2")
+	if err := cache.Write([]*PrometheusMetric{{Name: "aws_quota_ec2_test", Value: 1}}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	stores.remove()
+	if _, err := os.Stat(cache.FileName); !os.IsNotExist(err) {
+		t.Errorf("cache file %s not removed: %v", cache.FileName, err)
+	}
+	if _, err := cache.Read(); err != ErrCacheEmpty {
+		t.Errorf("Read() error = %v, want %v", err, ErrCacheEmpty)
+	}
+	if got := stores.get("ec2"); got == cache {
+		t.Errorf("get() returned the removed cache")
+	}
+}
+
 func FuzzNewCache(f *testing.F) {
 	type args struct {
 		fileName string
@@ -109,3 +128,20 @@ func FuzzNewCache(f *testing.F) {
 	)
 
 }
+
+func Test_cacheStores(t *testing.T) {
+	caches := newCacheStores(time.Minute, "123456789012")
+	ec2 := caches.get("ec2")
+	if ec2 == nil {
+		t.Fatal("cacheStores.get() = nil, want cache")
+	}
+	if !strings.HasPrefix(ec2.FileName, CacheFolder+"ec2") {
+		t.Errorf("cacheStores.get().FileName = %v, want prefix %v", ec2.FileName, CacheFolder+"ec2")
+	}
+	if caches.get("ec2") != ec2 {
+		t.Error("cacheStores.get() expected the same cache for the same service")
+	}
+	if caches.get("vpc") == ec2 {
+		t.Error("cacheStores.get() expected a new cache for another service")
+	}
+}
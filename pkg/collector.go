@@ -1,6 +1,7 @@
 package pkg
 
 import (
+	"fmt"
 	"regexp"
 	"sort"
 	"strings"
@@ -31,19 +32,56 @@ type PrometheusMetric struct {
 type PrometheusCollector struct {
 	mutex      *sync.RWMutex
 	getMetrics func() ([]*PrometheusMetric, error)
+	relabel    []compiledRelabelConfig
+	relabelErr error
+	close      func()
+	closed     bool
+}
+
+// CollectorOption configures a PrometheusCollector
+type CollectorOption func(p *PrometheusCollector)
+
+// WithRelabelConfigs rewrites the labels of the metrics, or drops metrics, before they are exposed
+func WithRelabelConfigs(configs []RelabelConfig) CollectorOption {
+	return func(p *PrometheusCollector) {
+		p.relabel, p.relabelErr = compileRelabelConfigs(configs)
+		if p.relabelErr != nil {
+			p.relabelErr = fmt.Errorf("invalid relabelConfigs: %w", p.relabelErr)
+		}
+	}
+}
+
+// WithClose sets the function releasing the resources of the collector (e.g. its cache files) when it is closed
+func WithClose(release func()) CollectorOption {
+	return func(p *PrometheusCollector) {
+		p.close = release
+	}
 }
 
 // NewPrometheusCollector is PrometheusCollector constructor
-func NewPrometheusCollector(getMetrics func() ([]*PrometheusMetric, error)) *PrometheusCollector {
-	return &PrometheusCollector{
+func NewPrometheusCollector(getMetrics func() ([]*PrometheusMetric, error), opts ...CollectorOption) *PrometheusCollector {
+	p := &PrometheusCollector{
 		getMetrics: getMetrics,
 		mutex:      new(sync.RWMutex),
 	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// metrics returns the relabeled metrics
+func (p *PrometheusCollector) metrics() ([]*PrometheusMetric, error) {
+	if p.relabelErr != nil {
+		return nil, p.relabelErr
+	}
+	data, err := p.getMetrics()
+	return relabel(data, p.relabel), err
 }
 
 // Describe metrics
 func (p *PrometheusCollector) Describe(descs chan<- *prometheus.Desc) {
-	data, err := p.getMetrics()
+	data, err := p.metrics()
 	if err != nil {
 		descs <- prometheus.NewInvalidDesc(err)
 		slog.Error("Error getting metrics", logGroup, "error", err)
@@ -59,7 +97,10 @@ func (p *PrometheusCollector) Collect(metrics chan<- prometheus.Metric) {
 	p.mutex.Lock() // To protect metrics from concurrent collects.
 	defer p.mutex.Unlock()
 
-	data, err := p.getMetrics()
+	if p.closed {
+		return
+	}
+	data, err := p.metrics()
 	if err != nil {
 		desc := prometheus.NewDesc(
 			"place_holder_prometheus_collector",
@@ -76,6 +117,17 @@ func (p *PrometheusCollector) Collect(metrics chan<- prometheus.Metric) {
 
 }
 
+// Close waits for the running collect and releases the resources of the collector, it does not collect anymore
+func (p *PrometheusCollector) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if !p.closed && p.close != nil {
+		p.close()
+	}
+	p.closed = true
+	return nil
+}
+
 func createDesc(metric *PrometheusMetric) *prometheus.Desc {
 	return prometheus.NewDesc(
 		metric.Name,
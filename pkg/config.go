@@ -1,39 +1,321 @@
 package pkg
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws/awsutil"
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
 )
 
-// QuotaConfig struct contains Jobs
+// QuotaConfig struct contains Jobs and the Defaults inherited by every job of every file.
+// The description, title, enum, pattern and length tags of the configuration structs
+// generate the JSON Schema of the configuration (see Schema), which also validates the configuration values.
 type QuotaConfig struct {
-	Jobs []JobConfig `yaml:"jobs"`
+	Endpoints *EndpointsConfig `yaml:"endpoints,omitempty" description:"Endpoint overrides inherited by the defaults and every job of every file."`
+	Defaults  JobConfig        `yaml:"defaults,omitempty" description:"Settings inherited by every job of every file, a setting cannot be set to different values in two files."`
+	Jobs      []JobConfig      `yaml:"jobs" description:"Jobs exporting the quotas of a service in regions."`
+	// relabeling rules applied to the metrics of every job of every file, after the rules of the job
+	RelabelConfigs []RelabelConfig `yaml:"relabelConfigs,omitempty" description:"Relabeling rules applied to the metrics of every job of every file, after the rules of the job."`
 }
 
 // JobConfig struct
 type JobConfig struct {
-	ServiceCode string   `yaml:"serviceCode"`
-	Regions     []string `yaml:"regions"`
-	Role        string   `yaml:"role,omitempty"`
-	AccountName string   `yaml:"accountName,omitempty"`
+	ServiceCode string   `yaml:"serviceCode" description:"Service code, glob pattern or /regex/ to discover services."`
+	Regions     []string `yaml:"regions" description:"Regions of the job, * for all the regions enabled in the account." title:"region" pattern:"^(\\*|[a-z]{2}(-[a-z]+)?-[a-z]+-[0-9]+)$"`
+	Role        string   `yaml:"role,omitempty" description:"IAM role assumed by the job, a template such as arn:aws:iam::{{.AccountID}}:role/quota-reader with accounts or organization." title:"role ARN" pattern:"^arn:[a-z-]+:iam::[^:]*:role/.+$"`
+	AccountName string   `yaml:"accountName,omitempty" description:"Name of the account exported in the account_name label."`
+	Profile     string   `yaml:"profile,omitempty" description:"Shared config profile (SSO, credential_process, source_profile...) used instead of the default credentials."`
+	// options of the STS AssumeRole calls, roleChain roles are assumed in order before role
+	ExternalID          string              `yaml:"externalId,omitempty" description:"External ID of the AssumeRole call of role, not sent to the roles of roleChain." pattern:"^[\\w+=,.@:/-]+$" minLength:"2" maxLength:"1224" secret:"true"`
+	SessionName         string              `yaml:"sessionName,omitempty" description:"Session name of the AssumeRole calls." pattern:"^[\\w+=,.@-]{2,64}$"`
+	SessionDuration     time.Duration       `yaml:"sessionDuration,omitempty" description:"Duration of the assumed role sessions, between 15m and 12h (1h with roleChain)."`
+	SourceIdentity      string              `yaml:"sourceIdentity,omitempty" description:"Source identity of the AssumeRole calls." pattern:"^[\\w+=,.@-]{2,64}$"`
+	RoleChain           []string            `yaml:"roleChain,omitempty" description:"Roles assumed in order before role." title:"role ARN" pattern:"^arn:[a-z-]+:iam::[^:]*:role/.+$"`
+	Endpoints           *EndpointsConfig    `yaml:"endpoints,omitempty" description:"Endpoint overrides of the AWS APIs, merged with the top-level endpoints."`
+	Accounts            []AccountConfig     `yaml:"accounts,omitempty" description:"Accounts scraped by the job, role is then a template."`
+	Organization        *OrganizationConfig `yaml:"organization,omitempty" description:"Accounts discovered from AWS Organizations instead of accounts."`
+	ExcludeRegions      []string            `yaml:"excludeRegions,omitempty" description:"Regions (or glob patterns) removed from regions."`
+	ExcludeServiceCodes []string            `yaml:"excludeServiceCodes,omitempty" description:"Service codes (glob patterns or /regex/) removed from the discovered services."`
+	Include             []QuotaFilter       `yaml:"include,omitempty" description:"Quotas kept, any rule matches."`
+	Exclude             []QuotaFilter       `yaml:"exclude,omitempty" description:"Quotas dropped, any rule matches."`
+	// optional overrides of the command-line values
+	CacheDuration *time.Duration `yaml:"cacheDuration,omitempty" description:"Cache expiry time, overrides -cache.duration."`
+	CollectUsage  *bool          `yaml:"collectUsage,omitempty" description:"Collect quotas usage, overrides -collect.usage."`
+	ServeStale    *bool          `yaml:"serveStale,omitempty" description:"Serve stale cache data during cache refresh, overrides -cache.serve-stale."`
+	ListMerge     string         `yaml:"listMerge,omitempty" description:"How lists set in both defaults and job are combined." enum:"replace,merge"`
+	// static labels added to every metric of the job, merged with the labels of the defaults
+	Labels map[string]string `yaml:"labels,omitempty" description:"Static labels added to every metric of the job, e.g. team and env."`
+	// CloudWatch window, period and statistic of the usage, by service and quota code
+	Usage *UsageConfig `yaml:"usage,omitempty" description:"CloudWatch lookback, period and statistic of the usage, with overrides by service code and serviceCode/quotaCode."`
+	// fixed metric names of quotas by serviceCode/quotaCode, they do not change when AWS renames a quota
+	MetricNames map[string]QuotaMetric `yaml:"metricNames,omitempty" description:"Fixed metric names (and extra labels) of quotas by serviceCode/quotaCode, e.g. ec2/L-1216C47A."`
+	// relabeling rules applied to the metrics of the job before they are exposed
+	RelabelConfigs []RelabelConfig `yaml:"relabelConfigs,omitempty" description:"Relabeling rules (Prometheus relabel_configs semantics) applied to the metrics of the job."`
+	// quota increase requests of the service (ListRequestedServiceQuotaChangeHistory), overrides the command-line value
+	CollectRequests *bool `yaml:"collectRequests,omitempty" description:"Collect the quota increase requests, overrides -collect.requests."`
+	// configuration file of the job, set when the configuration is loaded from a directory or glob pattern
+	Source string `yaml:"-"`
 }
 
-// NewQuotaConfig creates a new QuotaConfig
+// NewQuotaConfig creates a new QuotaConfig.
+// configFile is a file, a directory of *.yml files or a glob pattern, the files are merged in lexical order.
+// It can also be an http(s):// or s3:// URL.
+// ${VAR} and ${VAR:-default} are expanded in values, and values are read from files with file: and _file keys,
+// except in remote configurations: their authors could otherwise export the environment and files of the exporter.
+// Unknown keys and invalid jobs are reported as ConfigErrors with their file and line numbers.
 func NewQuotaConfig(configFile string) (*QuotaConfig, error) {
-	yamlFile, err := os.ReadFile(configFile)
+	if IsRemoteConfig(configFile) {
+		remote, err := newRemoteConfig(configFile)
+		if err != nil {
+			return nil, err
+		}
+		data, err := remote.Fetch(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		return parseRemoteConfig(data)
+	}
+	files, err := configFiles(configFile)
 	if err != nil {
 		return nil, err
 	}
+	fragments := make([]configFragment, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		fragment := configFragment{data: data}
+		// jobs and errors only name their file when the configuration has several files
+		if file != configFile {
+			fragment.file = file
+		}
+		fragments = append(fragments, fragment)
+	}
+	return parseFragments(fragments)
+}
+
+func parseQuotaConfig(data []byte) (*QuotaConfig, error) {
+	return parseFragments([]configFragment{{data: data}})
+}
+
+// parseRemoteConfig parses a configuration fetched over http or s3, without expanding ${VAR} and file references
+func parseRemoteConfig(data []byte) (*QuotaConfig, error) {
+	return parseFragments([]configFragment{{data: data, remote: true}})
+}
+
+// parseFragments merges the jobs of every fragment. The defaults, endpoints and relabelConfigs of the fragments are merged
+// in lexical order and apply to the jobs of every fragment: a default set to different values in two fragments is an error,
+// relabeling rules are appended.
+func parseFragments(fragments []configFragment) (*QuotaConfig, error) {
+	parsed := make([]*parsedFragment, 0, len(fragments))
+	for _, fragment := range fragments {
+		p, err := parseFragment(fragment)
+		if err != nil {
+			if fragment.file != "" {
+				return nil, fmt.Errorf("%s: %w", fragment.file, err)
+			}
+			return nil, err
+		}
+		p.file = fragment.file
+		parsed = append(parsed, p)
+	}
+
+	defaults, relabelConfigs, errs := mergeFragmentDefaults(parsed)
 	qcl := QuotaConfig{}
-	err = yaml.Unmarshal(yamlFile, &qcl)
-	if err != nil {
-		return nil, err
+	seen := map[string]jobPosition{}
+	for _, p := range parsed {
+		for _, e := range p.resolve(defaults, relabelConfigs, seen) {
+			e.File = p.file
+			errs = append(errs, e)
+		}
+		qcl.Jobs = append(qcl.Jobs, p.qcl.Jobs...)
+	}
+	if len(errs) > 0 {
+		// files are sorted, errors are sorted by file then line
+		sort.SliceStable(errs, func(i, j int) bool {
+			if errs[i].File != errs[j].File {
+				return errs[i].File < errs[j].File
+			}
+			return errs[i].Line < errs[j].Line
+		})
+		return nil, errs
 	}
 	return &qcl, nil
 }
 
+// parsedFragment is a decoded file of the configuration, before the defaults are applied to its jobs
+type parsedFragment struct {
+	file string
+	qcl  QuotaConfig
+	root yaml.Node
+	errs ConfigErrors
+	// the endpoints of the defaults are the top-level endpoints
+	topLevelEndpoints bool
+}
+
+// parseFragment decodes the configuration file of fragment
+func parseFragment(fragment configFragment) (*parsedFragment, error) {
+	p := &parsedFragment{}
+	data := fragment.data
+	if err := yaml.Unmarshal(data, &p.root); err != nil {
+		return nil, err
+	}
+
+	// expand environment variables and secret files, the decoding errors of the expanded
+	// document are reported at the lines of the original document
+	lines := map[int]int{}
+	if p.root.Kind != 0 && !fragment.remote {
+		e := newExpander()
+		expanded, encodedLines, err := expandConfig(&p.root, e)
+		if err != nil {
+			return nil, err
+		}
+		data, lines = expanded, encodedLines
+		p.errs = append(p.errs, e.errs...)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&p.qcl); err != nil && err != io.EOF {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return nil, err
+		}
+		for _, typeErr := range typeErrors(typeErr) {
+			if line, ok := lines[typeErr.Line]; ok {
+				typeErr.Line = line
+			}
+			p.errs = append(p.errs, typeErr)
+		}
+	}
+	if p.qcl.Endpoints != nil {
+		p.topLevelEndpoints = p.qcl.Defaults.Endpoints == nil
+		mergeValue(reflect.ValueOf(&p.qcl.Defaults).Elem(), reflect.ValueOf(JobConfig{Endpoints: p.qcl.Endpoints}), false)
+	}
+	return p, nil
+}
+
+// mergeFragmentDefaults merges the defaults (with the top-level endpoints) and the relabeling rules of the fragments in order.
+// A default set to different values in two fragments is reported in the later fragment.
+func mergeFragmentDefaults(parsed []*parsedFragment) (JobConfig, []RelabelConfig, ConfigErrors) {
+	defaults := JobConfig{}
+	relabelConfigs := []RelabelConfig{}
+	errs := ConfigErrors{}
+	type firstDefault struct {
+		file  string
+		value interface{}
+	}
+	first := map[string]firstDefault{} // first value of every default by path
+	for _, p := range parsed {
+		for _, leaf := range valueLeaves(reflect.ValueOf(p.qcl.Defaults), nil) {
+			key := strings.Join(leaf.path, ".")
+			f, ok := first[key]
+			if !ok {
+				first[key] = firstDefault{file: p.file, value: leaf.value}
+				continue
+			}
+			if !reflect.DeepEqual(f.value, leaf.value) {
+				errs = append(errs, ConfigError{File: p.file, Line: p.defaultLine(leaf.path), Msg: fmt.Sprintf("defaults %s conflicts with the defaults of %s", key, f.file)})
+			}
+		}
+		merged := p.qcl.Defaults
+		mergeValue(reflect.ValueOf(&merged).Elem(), reflect.ValueOf(defaults), false)
+		defaults = merged
+		relabelConfigs = append(relabelConfigs, p.qcl.RelabelConfigs...)
+	}
+	return defaults, relabelConfigs, errs
+}
+
+// defaultLine returns the line of the default at path in the fragment
+func (p *parsedFragment) defaultLine(path []string) int {
+	keys := make([]interface{}, 0, len(path)+1)
+	if !(p.topLevelEndpoints && path[0] == "endpoints") {
+		keys = append(keys, "defaults")
+	}
+	for _, key := range path {
+		keys = append(keys, key)
+	}
+	return lineOf(&p.root, keys...)
+}
+
+// resolve applies defaults to the jobs of the fragment and validates them, seen holds the jobs of the previous files
+// to report duplicates. The top-level relabelConfigs are applied after the rules of every job.
+func (p *parsedFragment) resolve(defaults JobConfig, relabelConfigs []RelabelConfig, seen map[string]jobPosition) ConfigErrors {
+	errs := append(ConfigErrors{}, p.errs...)
+	for i, job := range p.qcl.Jobs {
+		// an invalid listMerge is reported by validateSchema
+		p.qcl.Jobs[i], _ = applyDefaults(defaults, job)
+		p.qcl.Jobs[i].Source = p.file
+	}
+	validateSchema(configSchema, &p.root, "", &errs)
+	errs = append(errs, validateQuotaConfig(&p.qcl, &p.root, p.file, seen)...)
+	if len(relabelConfigs) > 0 {
+		for i, job := range p.qcl.Jobs {
+			p.qcl.Jobs[i].RelabelConfigs = append(append([]RelabelConfig{}, job.RelabelConfigs...), relabelConfigs...)
+		}
+	}
+	return errs
+}
+
+// Effective returns the resolved jobs (after defaults are applied) in YAML format,
+// the values of secret fields such as externalId are replaced with <secret>
+func (q *QuotaConfig) Effective() (string, error) {
+	var node yaml.Node
+	if err := node.Encode(QuotaConfig{Jobs: q.Jobs}); err != nil {
+		return "", err
+	}
+	redactSecrets(configSchema, &node)
+	var b bytes.Buffer
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return "", err
+	}
+	return b.String(), encoder.Close()
+}
+
+// GetCacheDuration returns the job cache duration or fallback when not set
+func (j JobConfig) GetCacheDuration(fallback time.Duration) time.Duration {
+	if j.CacheDuration != nil {
+		return *j.CacheDuration
+	}
+	return fallback
+}
+
+// GetCollectUsage returns whether the job collects usage or fallback when not set
+func (j JobConfig) GetCollectUsage(fallback bool) bool {
+	if j.CollectUsage != nil {
+		return *j.CollectUsage
+	}
+	return fallback
+}
+
+// GetCollectRequests returns whether the job collects quota increase requests or fallback when not set
+func (j JobConfig) GetCollectRequests(fallback bool) bool {
+	if j.CollectRequests != nil {
+		return *j.CollectRequests
+	}
+	return fallback
+}
+
+// GetServeStale returns whether the job serves stale cache data or fallback when not set
+func (j JobConfig) GetServeStale(fallback bool) bool {
+	if j.ServeStale != nil {
+		return *j.ServeStale
+	}
+	return fallback
+}
+
 // String returns a string representation of QuotaConfig
 func (q *QuotaConfig) String() string {
 	return awsutil.Prettify(q)
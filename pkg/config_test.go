@@ -1,8 +1,11 @@
 package pkg
 
 import (
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewQuotaConfig(t *testing.T) {
@@ -61,3 +64,78 @@ func TestNewQuotaConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestQuotaConfig_Effective(t *testing.T) {
+	qcl := &QuotaConfig{Jobs: []JobConfig{
+		{ServiceCode: "ec2", Regions: []string{"us-west-2"}, Role: "arn:aws:iam::111111111111:role/quota-reader", ExternalID: "s3cr3t-id"},
+		{ServiceCode: "lambda", Regions: []string{"us-west-2"}},
+	}}
+	effective, err := qcl.Effective()
+	if err != nil {
+		t.Fatalf("Effective() error = %v", err)
+	}
+	if strings.Contains(effective, "s3cr3t-id") || strings.Count(effective, "externalId: <secret>") != 1 {
+		t.Errorf("Effective() = %s, want the external id replaced with <secret>", effective)
+	}
+	if qcl.Jobs[0].ExternalID != "s3cr3t-id" {
+		t.Errorf("Effective() changed the external id of the job to %q", qcl.Jobs[0].ExternalID)
+	}
+}
+
+func TestJobConfig_Overrides(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, configFile, `jobs:
+  - serviceCode: ec2
+    regions: [us-west-2]
+    cacheDuration: 1m
+    collectUsage: true
+    serveStale: false
+    collectRequests: true
+  - serviceCode: cloudformation
+    regions: [us-west-2]
+`)
+	qcl, err := NewQuotaConfig(configFile)
+	if err != nil {
+		t.Fatalf("NewQuotaConfig() error = %v", err)
+	}
+	tests := []struct {
+		name              string
+		job               JobConfig
+		wantCacheDuration time.Duration
+		wantCollectUsage  bool
+		wantServeStale    bool
+		wantRequests      bool
+	}{
+		{
+			name:              "job overrides command-line values",
+			job:               qcl.Jobs[0],
+			wantCacheDuration: time.Minute,
+			wantCollectUsage:  true,
+			wantServeStale:    false,
+			wantRequests:      true,
+		},
+		{
+			name:              "job falls back to command-line values",
+			job:               qcl.Jobs[1],
+			wantCacheDuration: time.Hour,
+			wantCollectUsage:  false,
+			wantServeStale:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.job.GetCacheDuration(time.Hour); got != tt.wantCacheDuration {
+				t.Errorf("GetCacheDuration() = %v, want %v", got, tt.wantCacheDuration)
+			}
+			if got := tt.job.GetCollectUsage(false); got != tt.wantCollectUsage {
+				t.Errorf("GetCollectUsage() = %v, want %v", got, tt.wantCollectUsage)
+			}
+			if got := tt.job.GetServeStale(true); got != tt.wantServeStale {
+				t.Errorf("GetServeStale() = %v, want %v", got, tt.wantServeStale)
+			}
+			if got := tt.job.GetCollectRequests(false); got != tt.wantRequests {
+				t.Errorf("GetCollectRequests() = %v, want %v", got, tt.wantRequests)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package pkg
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// assumeRoleOptions are passed to STS when the roles of a job are assumed
+type assumeRoleOptions struct {
+	externalID      string
+	sessionName     string
+	sessionDuration time.Duration
+	sourceIdentity  string
+	roleChain       []string
+}
+
+// assumeRoleOptions returns the options used to assume the roles of the job
+func (j JobConfig) assumeRoleOptions() assumeRoleOptions {
+	return assumeRoleOptions{
+		externalID:      j.ExternalID,
+		sessionName:     j.SessionName,
+		sessionDuration: j.SessionDuration,
+		sourceIdentity:  j.SourceIdentity,
+		roleChain:       j.RoleChain,
+	}
+}
+
+// apply sets the options on the STS provider, unset options keep the SDK defaults
+func (o assumeRoleOptions) apply(p *stscreds.AssumeRoleOptions) {
+	if o.externalID != "" {
+		p.ExternalID = aws.String(o.externalID)
+	}
+	if o.sessionName != "" {
+		p.RoleSessionName = o.sessionName
+	}
+	if o.sessionDuration > 0 {
+		p.Duration = o.sessionDuration
+	}
+	if o.sourceIdentity != "" {
+		p.SourceIdentity = aws.String(o.sourceIdentity)
+	}
+}
+
+// assumeRole returns a copy of cfg with the credentials of role.
+// The roles of the chain are assumed first, in order, each one with the credentials of the previous one.
+// The external ID is only sent to assume role, the roles of the chain are trusted by their own accounts.
+func assumeRole(cfg aws.Config, role string, opts assumeRoleOptions, newClient func(cfg aws.Config) stscreds.AssumeRoleAPIClient) aws.Config {
+	hopOpts := opts
+	hopOpts.externalID = ""
+	for _, r := range opts.roleChain {
+		cfg.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(newClient(cfg), r, hopOpts.apply))
+	}
+	cfg.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(newClient(cfg), role, opts.apply))
+	return cfg
+}
+
+// newSTSClient returns a constructor of STS clients using the endpoint overrides
+func newSTSClient(endpoints *EndpointsConfig) func(cfg aws.Config) stscreds.AssumeRoleAPIClient {
+	return func(cfg aws.Config) stscreds.AssumeRoleAPIClient {
+		return sts.NewFromConfig(cfg, endpoints.stsOptions)
+	}
+}
@@ -0,0 +1,120 @@
+package pkg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	stsTypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// MockSTSClient returns credentials whose access key is the assumed role,
+// and records every AssumeRole call with the access key of its caller
+type MockSTSClient struct {
+	creds aws.CredentialsProvider
+	calls *[]sts.AssumeRoleInput
+}
+
+func (m *MockSTSClient) AssumeRole(ctx context.Context, params *sts.AssumeRoleInput, optFns ...func(*sts.Options)) (*sts.AssumeRoleOutput, error) {
+	caller := "default"
+	if m.creds != nil {
+		c, err := m.creds.Retrieve(ctx)
+		if err != nil {
+			return nil, err
+		}
+		caller = c.AccessKeyID
+	}
+	input := *params
+	input.Policy = aws.String(caller) // caller recorded in an unused field
+	*m.calls = append(*m.calls, input)
+	return &sts.AssumeRoleOutput{Credentials: &stsTypes.Credentials{
+		AccessKeyId:     params.RoleArn,
+		SecretAccessKey: aws.String("secret"),
+		SessionToken:    aws.String("token"),
+		Expiration:      aws.Time(time.Now().Add(time.Hour)),
+	}}, nil
+}
+
+func Test_assumeRole(t *testing.T) {
+	hub := "arn:aws:iam::111111111111:role/hub"
+	spoke := "arn:aws:iam::222222222222:role/spoke"
+	calls := []sts.AssumeRoleInput{}
+	newClient := func(cfg aws.Config) stscreds.AssumeRoleAPIClient {
+		return &MockSTSClient{creds: cfg.Credentials, calls: &calls}
+	}
+	opts := assumeRoleOptions{
+		externalID:      "secret-id",
+		sessionName:     "aws-quota-exporter",
+		sessionDuration: 30 * time.Minute,
+		sourceIdentity:  "exporter",
+		roleChain:       []string{hub},
+	}
+
+	cfg := assumeRole(aws.Config{}, spoke, opts, newClient)
+	creds, err := cfg.Credentials.Retrieve(context.Background())
+	if err != nil {
+		t.Fatalf("Retrieve() error = %v", err)
+	}
+	if creds.AccessKeyID != spoke {
+		t.Errorf("credentials of %s, want %s", creds.AccessKeyID, spoke)
+	}
+
+	// the external ID is only sent to the last role
+	want := []struct{ role, caller, externalID string }{{hub, "default", ""}, {spoke, hub, "secret-id"}}
+	if len(calls) != len(want) {
+		t.Fatalf("%d AssumeRole calls, want %d", len(calls), len(want))
+	}
+	for i, w := range want {
+		c := calls[i]
+		if *c.RoleArn != w.role || *c.Policy != w.caller {
+			t.Errorf("call %d assumed %s as %s, want %s as %s", i, *c.RoleArn, *c.Policy, w.role, w.caller)
+		}
+		got := []interface{}{aws.ToString(c.ExternalId), *c.RoleSessionName, *c.DurationSeconds, *c.SourceIdentity}
+		want := []interface{}{w.externalID, "aws-quota-exporter", int32(1800), "exporter"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("call %d options = %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestScraper_getAWSConfig(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(configFile, []byte("[profile dev]\nregion = eu-west-1\naws_access_key_id = AKIDDEV\naws_secret_access_key = secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_CONFIG_FILE", configFile)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+	s := &Scraper{cfg: aws.Config{Region: "default"}}
+	role := "arn:aws:iam::111111111111:role/quota-reader"
+
+	tests := []struct {
+		name       string
+		job        JobConfig
+		role       string
+		wantRegion string
+		wantErr    bool
+	}{
+		{name: "default config", job: JobConfig{}, wantRegion: "default"},
+		{name: "profile", job: JobConfig{Profile: "dev"}, wantRegion: "eu-west-1"},
+		{name: "profile and role", job: JobConfig{Profile: "dev"}, role: role, wantRegion: "eu-west-1"},
+		{name: "missing profile", job: JobConfig{Profile: "missing"}, wantErr: true},
+		{name: "invalid role", job: JobConfig{}, role: "arn:aws:iam::111111111111:user/quota-reader", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := s.getAWSConfig(tt.job, tt.role)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getAWSConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if cfg.Region != tt.wantRegion {
+				t.Errorf("getAWSConfig() region = %v, want %v", cfg.Region, tt.wantRegion)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package pkg
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	// ListMergeReplace replaces the default lists with the job lists (default)
+	ListMergeReplace = "replace"
+	// ListMergeMerge appends the job lists to the default lists
+	ListMergeMerge = "merge"
+)
+
+// applyDefaults returns job with every unset field inherited from defaults.
+// Lists set on both are replaced or merged depending on the listMerge option of the job (or of the defaults).
+func applyDefaults(defaults, job JobConfig) (JobConfig, error) {
+	strategy := job.ListMerge
+	if strategy == "" {
+		strategy = defaults.ListMerge
+	}
+	switch strategy {
+	case "", ListMergeReplace, ListMergeMerge:
+	default:
+		return job, fmt.Errorf("invalid listMerge %q for job %q, must be one of %q or %q", strategy, job.ServiceCode, ListMergeReplace, ListMergeMerge)
+	}
+
+	merged := reflect.ValueOf(&job).Elem()
+	mergeValue(merged, reflect.ValueOf(defaults), strategy == ListMergeMerge)
+	job.ListMerge = ""
+	return job, nil
+}
+
+// mergeValue sets the zero fields of dst to the values of src, recursing into structs and maps
+func mergeValue(dst, src reflect.Value, mergeLists bool) {
+	switch dst.Kind() {
+	case reflect.Struct:
+		for i := 0; i < dst.NumField(); i++ {
+			if !dst.Type().Field(i).IsExported() {
+				continue
+			}
+			mergeValue(dst.Field(i), src.Field(i), mergeLists)
+		}
+	case reflect.Ptr:
+		if src.IsNil() {
+			return
+		}
+		if dst.IsNil() {
+			dst.Set(src)
+			return
+		}
+		if dst.Elem().Kind() == reflect.Struct {
+			elem := reflect.New(dst.Elem().Type())
+			elem.Elem().Set(dst.Elem())
+			mergeValue(elem.Elem(), src.Elem(), mergeLists)
+			dst.Set(elem)
+		}
+	case reflect.Slice:
+		if src.Len() == 0 {
+			return
+		}
+		if dst.Len() == 0 {
+			dst.Set(reflect.AppendSlice(reflect.MakeSlice(src.Type(), 0, src.Len()), src))
+			return
+		}
+		if !mergeLists {
+			return
+		}
+		merged := reflect.AppendSlice(reflect.MakeSlice(src.Type(), 0, src.Len()+dst.Len()), src)
+		for i := 0; i < dst.Len(); i++ {
+			if !containsValue(merged, dst.Index(i)) {
+				merged = reflect.Append(merged, dst.Index(i))
+			}
+		}
+		dst.Set(merged)
+	case reflect.Map:
+		if src.Len() == 0 {
+			return
+		}
+		merged := reflect.MakeMapWithSize(src.Type(), src.Len()+dst.Len())
+		iter := src.MapRange()
+		for iter.Next() {
+			merged.SetMapIndex(iter.Key(), iter.Value())
+		}
+		iter = dst.MapRange()
+		for iter.Next() {
+			merged.SetMapIndex(iter.Key(), iter.Value())
+		}
+		dst.Set(merged)
+	default:
+		if dst.IsZero() {
+			dst.Set(src)
+		}
+	}
+}
+
+func containsValue(list, v reflect.Value) bool {
+	for i := 0; i < list.Len(); i++ {
+		if reflect.DeepEqual(list.Index(i).Interface(), v.Interface()) {
+			return true
+		}
+	}
+	return false
+}
+
+// valueLeaf is a set value of a configuration struct at its path of YAML keys
+type valueLeaf struct {
+	path  []string
+	value interface{}
+}
+
+// valueLeaves returns the set values of v: scalars, lists and map entries, recursing into structs
+func valueLeaves(v reflect.Value, path []string) []valueLeaf {
+	leaves := []valueLeaf{}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			leaves = valueLeaves(v.Elem(), path)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			tag := field.Tag.Get("yaml")
+			name := strings.Split(tag, ",")[0]
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			fieldPath := append(append([]string{}, path...), name)
+			if field.Anonymous && strings.Contains(tag, ",inline") {
+				fieldPath = path
+			}
+			leaves = append(leaves, valueLeaves(v.Field(i), fieldPath)...)
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, key := range keys {
+			leaves = append(leaves, valueLeaf{path: append(append([]string{}, path...), key.String()), value: v.MapIndex(key).Interface()})
+		}
+	case reflect.Slice:
+		if v.Len() > 0 {
+			leaves = append(leaves, valueLeaf{path: path, value: v.Interface()})
+		}
+	default:
+		if !v.IsZero() {
+			leaves = append(leaves, valueLeaf{path: path, value: v.Interface()})
+		}
+	}
+	return leaves
+}
@@ -0,0 +1,88 @@
+package pkg
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_applyDefaults(t *testing.T) {
+	minute := time.Minute
+	hour := time.Hour
+	defaults := JobConfig{
+		Regions:       []string{"us-east-1", "us-west-2"},
+		Role:          "arn:aws:iam::012345678901:role/aws-quota-exporter",
+		AccountName:   "prod-account",
+		CacheDuration: &hour,
+	}
+	tests := []struct {
+		name     string
+		defaults JobConfig
+		job      JobConfig
+		want     JobConfig
+		wantErr  bool
+	}{
+		{
+			name:     "job inherits unset fields",
+			defaults: defaults,
+			job:      JobConfig{ServiceCode: "lambda"},
+			want: JobConfig{
+				ServiceCode:   "lambda",
+				Regions:       []string{"us-east-1", "us-west-2"},
+				Role:          "arn:aws:iam::012345678901:role/aws-quota-exporter",
+				AccountName:   "prod-account",
+				CacheDuration: &hour,
+			},
+		},
+		{
+			name:     "job overrides fields and replaces lists",
+			defaults: defaults,
+			job:      JobConfig{ServiceCode: "ec2", Regions: []string{"eu-west-1"}, AccountName: "dev-account", CacheDuration: &minute},
+			want: JobConfig{
+				ServiceCode:   "ec2",
+				Regions:       []string{"eu-west-1"},
+				Role:          "arn:aws:iam::012345678901:role/aws-quota-exporter",
+				AccountName:   "dev-account",
+				CacheDuration: &minute,
+			},
+		},
+		{
+			name:     "job merges lists",
+			defaults: defaults,
+			job:      JobConfig{ServiceCode: "ec2", Regions: []string{"eu-west-1", "us-east-1"}, ListMerge: ListMergeMerge},
+			want: JobConfig{
+				ServiceCode:   "ec2",
+				Regions:       []string{"us-east-1", "us-west-2", "eu-west-1"},
+				Role:          "arn:aws:iam::012345678901:role/aws-quota-exporter",
+				AccountName:   "prod-account",
+				CacheDuration: &hour,
+			},
+		},
+		{
+			name:     "defaults merge lists",
+			defaults: JobConfig{Regions: []string{"us-east-1"}, ListMerge: ListMergeMerge},
+			job:      JobConfig{ServiceCode: "ec2", Regions: []string{"eu-west-1"}},
+			want:     JobConfig{ServiceCode: "ec2", Regions: []string{"us-east-1", "eu-west-1"}},
+		},
+		{
+			name:     "invalid listMerge",
+			defaults: defaults,
+			job:      JobConfig{ServiceCode: "ec2", ListMerge: "append"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyDefaults(tt.defaults, tt.job)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyDefaults() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("applyDefaults() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,308 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	sq "github.com/aws/aws-sdk-go-v2/service/servicequotas"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// RegionWildcard in JobConfig.Regions is replaced by all the regions enabled in the account
+	RegionWildcard = "*"
+	// DefaultDiscoveryInterval is how often discovered regions and services are refreshed
+	DefaultDiscoveryInterval = time.Hour
+	// discoveryRegion is used to call discovery APIs when no region is configured
+	discoveryRegion = "us-east-1"
+)
+
+var (
+	// ErrNoRegions is returned when the regions of a job could not be resolved
+	ErrNoRegions = errors.New("No regions resolved")
+	// ErrNoServices is returned when the service codes of a job could not be resolved
+	ErrNoServices = errors.New("No service codes resolved")
+)
+
+// EC2Client interface for easier testing
+type EC2Client interface {
+	DescribeRegions(ctx context.Context, params *ec2.DescribeRegionsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeRegionsOutput, error)
+}
+
+// ServiceQuotasClient interface for easier testing
+type ServiceQuotasClient interface {
+	ListServices(ctx context.Context, params *sq.ListServicesInput, optFns ...func(*sq.Options)) (*sq.ListServicesOutput, error)
+}
+
+// discoveryCache keeps a discovered list for interval.
+// The last known list is kept if a refresh fails.
+type discoveryCache[T any] struct {
+	mutex    *sync.Mutex
+	interval time.Duration
+	resolved []T
+	expires  time.Time
+}
+
+func newDiscoveryCache[T any](interval time.Duration) discoveryCache[T] {
+	return discoveryCache[T]{mutex: new(sync.Mutex), interval: interval}
+}
+
+// get returns the cached list or refreshes it with list when expired
+func (d *discoveryCache[T]) get(list func() ([]T, error), errEmpty error) ([]T, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.resolved != nil && time.Now().Before(d.expires) {
+		return d.resolved, nil
+	}
+
+	resolved, err := list()
+	if err != nil {
+		if d.resolved == nil {
+			return nil, errors.Join(errEmpty, err)
+		}
+		slog.Warn("Failed to refresh discovery, using last known values", "error", err, "values", d.resolved)
+		d.expires = time.Now().Add(d.interval)
+		return d.resolved, nil
+	}
+	d.resolved = resolved
+	d.expires = time.Now().Add(d.interval)
+	slog.Debug("Discovery refreshed", "values", d.resolved)
+	return d.resolved, nil
+}
+
+// regionResolver resolves the regions of a job.
+// When the job regions contain RegionWildcard, the regions enabled in the account are listed
+// and refreshed every interval.
+type regionResolver struct {
+	discoveryCache[string]
+	regions   []string
+	exclude   []*pattern
+	newClient func(cfg aws.Config) EC2Client
+}
+
+func newRegionResolver(job JobConfig, interval time.Duration) (*regionResolver, error) {
+	exclude, err := compilePatterns(job.ExcludeRegions)
+	if err != nil {
+		return nil, fmt.Errorf("invalid excludeRegions: %w", err)
+	}
+	return &regionResolver{
+		discoveryCache: newDiscoveryCache[string](interval),
+		regions:        job.Regions,
+		exclude:        exclude,
+		newClient: func(cfg aws.Config) EC2Client {
+			return ec2.NewFromConfig(cfg)
+		},
+	}, nil
+}
+
+// isDynamic returns true when regions are discovered from the account
+func (r *regionResolver) isDynamic() bool {
+	return contains(r.regions, RegionWildcard)
+}
+
+// Regions returns the job regions, resolving RegionWildcard with the credentials of cfg
+func (r *regionResolver) Regions(ctx context.Context, cfg aws.Config) ([]string, error) {
+	if !r.isDynamic() {
+		return filterPatterns(r.regions, r.exclude), nil
+	}
+	return r.get(func() ([]string, error) {
+		regions, err := listEnabledRegions(ctx, r.newClient(cfg), cfg.Region)
+		if err != nil {
+			return nil, err
+		}
+		for _, region := range r.regions {
+			if region != RegionWildcard && !contains(regions, region) {
+				regions = append(regions, region)
+			}
+		}
+		return filterPatterns(regions, r.exclude), nil
+	}, ErrNoRegions)
+}
+
+// serviceResolver resolves the service codes of a job.
+// When the job service code is a pattern, the services are listed and refreshed every interval.
+type serviceResolver struct {
+	discoveryCache[string]
+	serviceCode *pattern
+	exclude     []*pattern
+	newClient   func(cfg aws.Config) ServiceQuotasClient
+}
+
+func newServiceResolver(job JobConfig, interval time.Duration) (*serviceResolver, error) {
+	serviceCode, err := compilePattern(job.ServiceCode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid serviceCode: %w", err)
+	}
+	exclude, err := compilePatterns(job.ExcludeServiceCodes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid excludeServiceCodes: %w", err)
+	}
+	return &serviceResolver{
+		discoveryCache: newDiscoveryCache[string](interval),
+		serviceCode:    serviceCode,
+		exclude:        exclude,
+		newClient: func(cfg aws.Config) ServiceQuotasClient {
+			return sq.NewFromConfig(cfg, job.Endpoints.serviceQuotasOptions)
+		},
+	}, nil
+}
+
+// isDynamic returns true when service codes are discovered with ListServices
+func (r *serviceResolver) isDynamic() bool {
+	return isPattern(r.serviceCode.text)
+}
+
+// ServiceCodes returns the job service codes, listing the services matching the pattern with the credentials of cfg
+func (r *serviceResolver) ServiceCodes(ctx context.Context, cfg aws.Config) ([]string, error) {
+	if !r.isDynamic() {
+		return filterPatterns([]string{r.serviceCode.text}, r.exclude), nil
+	}
+	return r.get(func() ([]string, error) {
+		services, err := listServiceCodes(ctx, r.newClient(cfg), cfg.Region)
+		if err != nil {
+			return nil, err
+		}
+		matched := []string{}
+		for _, service := range services {
+			if r.serviceCode.match(service) {
+				matched = append(matched, service)
+			}
+		}
+		return filterPatterns(matched, r.exclude), nil
+	}, ErrNoServices)
+}
+
+// listEnabledRegions lists the regions enabled in the account (opted-in or not requiring opt-in)
+func listEnabledRegions(ctx context.Context, client EC2Client, region string) ([]string, error) {
+	if region == "" {
+		region = discoveryRegion
+	}
+	out, err := client.DescribeRegions(ctx, &ec2.DescribeRegionsInput{AllRegions: aws.Bool(false)}, func(o *ec2.Options) { o.Region = region })
+	if err != nil {
+		return nil, err
+	}
+	regions := []string{}
+	for _, r := range out.Regions {
+		if r.RegionName != nil {
+			regions = append(regions, *r.RegionName)
+		}
+	}
+	sort.Strings(regions)
+	return regions, nil
+}
+
+// listServiceCodes lists the codes of all the services available in Service Quotas
+func listServiceCodes(ctx context.Context, client ServiceQuotasClient, region string) ([]string, error) {
+	if region == "" {
+		region = discoveryRegion
+	}
+	opts := func(o *sq.Options) { o.Region = region }
+	input := &sq.ListServicesInput{MaxResults: &maxResults}
+	services := []string{}
+	for {
+		r, err := client.ListServices(ctx, input, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, service := range r.Services {
+			if service.ServiceCode != nil {
+				services = append(services, *service.ServiceCode)
+			}
+		}
+		if r.NextToken == nil {
+			break
+		}
+		input.NextToken = r.NextToken
+	}
+	sort.Strings(services)
+	return services, nil
+}
+
+// isPattern returns true if text is a regular expression (/regex/) or a glob pattern
+func isPattern(text string) bool {
+	return isRegexPattern(text) || strings.ContainsAny(text, "*?[")
+}
+
+func isRegexPattern(text string) bool {
+	return len(text) > 2 && strings.HasPrefix(text, "/") && strings.HasSuffix(text, "/")
+}
+
+// pattern is a compiled regular expression (/regex/), glob pattern or plain string
+type pattern struct {
+	text string
+	re   *regexp.Regexp
+}
+
+// compilePattern compiles the regular expression of text once, to match it against many texts
+func compilePattern(text string) (*pattern, error) {
+	p := &pattern{text: text}
+	if isRegexPattern(text) {
+		re, err := regexp.Compile(text[1 : len(text)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %w", text, err)
+		}
+		p.re = re
+	}
+	return p, nil
+}
+
+// compilePatterns compiles every pattern of texts
+func compilePatterns(texts []string) ([]*pattern, error) {
+	patterns := make([]*pattern, 0, len(texts))
+	for _, text := range texts {
+		p, err := compilePattern(text)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// match matches text against the pattern
+func (p *pattern) match(text string) bool {
+	if p.re != nil {
+		return p.re.MatchString(text)
+	}
+	ok, _ := path.Match(p.text, text)
+	return ok
+}
+
+// filterPatterns removes items matching any of the exclude patterns
+func filterPatterns(items []string, exclude []*pattern) []string {
+	if len(exclude) == 0 {
+		return items
+	}
+	filtered := []string{}
+	for _, item := range items {
+		excluded := false
+		for _, p := range exclude {
+			if p.match(item) {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered
+}
+
+func contains(list []string, item string) bool {
+	for _, i := range list {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,227 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	sq "github.com/aws/aws-sdk-go-v2/service/servicequotas"
+	sqTypes "github.com/aws/aws-sdk-go-v2/service/servicequotas/types"
+)
+
+type MockEC2Client struct {
+	regions []string
+	err     error
+	calls   int
+}
+
+func (m *MockEC2Client) DescribeRegions(ctx context.Context, params *ec2.DescribeRegionsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeRegionsOutput, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	out := &ec2.DescribeRegionsOutput{}
+	for _, r := range m.regions {
+		out.Regions = append(out.Regions, ec2Types.Region{RegionName: aws.String(r)})
+	}
+	return out, nil
+}
+
+func TestRegionResolver_Regions(t *testing.T) {
+	enabled := []string{"us-west-2", "us-east-1", "ap-east-1", "eu-west-1"}
+	tests := []struct {
+		name    string
+		job     JobConfig
+		client  *MockEC2Client
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "static regions",
+			job:    JobConfig{Regions: []string{"us-west-2", "us-east-2"}},
+			client: &MockEC2Client{regions: enabled},
+			want:   []string{"us-west-2", "us-east-2"},
+		},
+		{
+			name:   "static regions with exclude",
+			job:    JobConfig{Regions: []string{"us-west-2", "us-east-2"}, ExcludeRegions: []string{"us-east-2"}},
+			client: &MockEC2Client{regions: enabled},
+			want:   []string{"us-west-2"},
+		},
+		{
+			name:   "wildcard",
+			job:    JobConfig{Regions: []string{"*"}},
+			client: &MockEC2Client{regions: enabled},
+			want:   []string{"ap-east-1", "eu-west-1", "us-east-1", "us-west-2"},
+		},
+		{
+			name:   "wildcard with exclude patterns",
+			job:    JobConfig{Regions: []string{"*"}, ExcludeRegions: []string{"ap-*", "eu-west-1"}},
+			client: &MockEC2Client{regions: enabled},
+			want:   []string{"us-east-1", "us-west-2"},
+		},
+		{
+			name:   "wildcard with extra region",
+			job:    JobConfig{Regions: []string{"*", "me-south-1"}},
+			client: &MockEC2Client{regions: []string{"us-east-1"}},
+			want:   []string{"us-east-1", "me-south-1"},
+		},
+		{
+			name:    "wildcard discovery error",
+			job:     JobConfig{Regions: []string{"*"}},
+			client:  &MockEC2Client{err: errors.New("AccessDenied")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := newRegionResolver(tt.job, time.Hour)
+			if err != nil {
+				t.Fatalf("newRegionResolver() error = %v", err)
+			}
+			r.newClient = func(cfg aws.Config) EC2Client { return tt.client }
+			got, err := r.Regions(context.TODO(), aws.Config{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Regions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Regions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegionResolver_Refresh(t *testing.T) {
+	client := &MockEC2Client{regions: []string{"us-east-1"}}
+	r, _ := newRegionResolver(JobConfig{Regions: []string{"*"}}, time.Hour)
+	r.newClient = func(cfg aws.Config) EC2Client { return client }
+
+	if _, err := r.Regions(context.TODO(), aws.Config{}); err != nil {
+		t.Fatalf("Regions() error = %v", err)
+	}
+	// cached until expiry
+	client.regions = []string{"us-east-1", "eu-south-1"}
+	got, _ := r.Regions(context.TODO(), aws.Config{})
+	if client.calls != 1 || !reflect.DeepEqual(got, []string{"us-east-1"}) {
+		t.Errorf("Regions() = %v after %d calls, want cached regions", got, client.calls)
+	}
+	// refreshed after expiry
+	r.expires = time.Now()
+	got, _ = r.Regions(context.TODO(), aws.Config{})
+	if !reflect.DeepEqual(got, []string{"eu-south-1", "us-east-1"}) {
+		t.Errorf("Regions() = %v, want refreshed regions", got)
+	}
+	// last known regions kept on error
+	r.expires = time.Now()
+	client.err = errors.New("Throttling")
+	got, err := r.Regions(context.TODO(), aws.Config{})
+	if err != nil || !reflect.DeepEqual(got, []string{"eu-south-1", "us-east-1"}) {
+		t.Errorf("Regions() = %v, %v, want last known regions", got, err)
+	}
+}
+
+type MockServiceQuotasClient struct {
+	ServiceQuotasClient
+	pages [][]string
+}
+
+func (m *MockServiceQuotasClient) ListServices(ctx context.Context, params *sq.ListServicesInput, optFns ...func(*sq.Options)) (*sq.ListServicesOutput, error) {
+	page := 0
+	if params.NextToken != nil {
+		page, _ = strconv.Atoi(*params.NextToken)
+	}
+	out := &sq.ListServicesOutput{}
+	for _, code := range m.pages[page] {
+		out.Services = append(out.Services, sqTypes.ServiceInfo{ServiceCode: aws.String(code)})
+	}
+	if page+1 < len(m.pages) {
+		out.NextToken = aws.String(strconv.Itoa(page + 1))
+	}
+	return out, nil
+}
+
+func TestServiceResolver_ServiceCodes(t *testing.T) {
+	client := &MockServiceQuotasClient{pages: [][]string{{"ec2", "ebs", "lambda"}, {"vpc", "elasticloadbalancing"}}}
+	tests := []struct {
+		name string
+		job  JobConfig
+		want []string
+	}{
+		{
+			name: "static service code",
+			job:  JobConfig{ServiceCode: "lambda"},
+			want: []string{"lambda"},
+		},
+		{
+			name: "all services",
+			job:  JobConfig{ServiceCode: "*"},
+			want: []string{"ebs", "ec2", "elasticloadbalancing", "lambda", "vpc"},
+		},
+		{
+			name: "glob with exclude",
+			job:  JobConfig{ServiceCode: "e*", ExcludeServiceCodes: []string{"elastic*"}},
+			want: []string{"ebs", "ec2"},
+		},
+		{
+			name: "regex",
+			job:  JobConfig{ServiceCode: "/^(ec2|vpc)$/"},
+			want: []string{"ec2", "vpc"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := newServiceResolver(tt.job, time.Hour)
+			if err != nil {
+				t.Fatalf("newServiceResolver() error = %v", err)
+			}
+			r.newClient = func(cfg aws.Config) ServiceQuotasClient { return client }
+			got, err := r.ServiceCodes(context.TODO(), aws.Config{})
+			if err != nil {
+				t.Fatalf("ServiceCodes() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ServiceCodes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_pattern_match(t *testing.T) {
+	tests := []struct {
+		pattern string
+		text    string
+		want    bool
+	}{
+		{"ec2", "ec2", true},
+		{"ec2", "ec", false},
+		{"*", "lambda", true},
+		{"us-*", "us-east-1", true},
+		{"us-*", "eu-west-1", false},
+		{"/^e(c2|bs)$/", "ebs", true},
+		{"/^e(c2|bs)$/", "ecs", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+"_"+tt.text, func(t *testing.T) {
+			p, err := compilePattern(tt.pattern)
+			if err != nil {
+				t.Fatalf("compilePattern(%q) error = %v", tt.pattern, err)
+			}
+			if got := p.match(tt.text); got != tt.want {
+				t.Errorf("match(%q, %q) = %v, want %v", tt.pattern, tt.text, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := compilePattern("/[/"); err == nil {
+		t.Error("compilePattern(\"/[/\") error = nil, want an invalid regular expression")
+	}
+	if _, err := newServiceResolver(JobConfig{ServiceCode: "ec2", ExcludeServiceCodes: []string{"/(/"}}, time.Hour); err == nil {
+		t.Error("newServiceResolver() error = nil, want an invalid regular expression")
+	}
+}
@@ -0,0 +1,120 @@
+package pkg
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cw "github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	sq "github.com/aws/aws-sdk-go-v2/service/servicequotas"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// EndpointsConfig overrides the endpoints of the AWS APIs called by a job,
+// e.g. VPC interface endpoints or LocalStack
+type EndpointsConfig struct {
+	ServiceQuotas string `yaml:"servicequotas,omitempty" description:"URL of the Service Quotas endpoint."`
+	CloudWatch    string `yaml:"cloudwatch,omitempty" description:"URL of the CloudWatch endpoint."`
+	STS           string `yaml:"sts,omitempty" description:"URL of the STS endpoint."`
+	FIPS          *bool  `yaml:"fips,omitempty" description:"Use the FIPS endpoints."`
+	DualStack     *bool  `yaml:"dualStack,omitempty" description:"Use the dual-stack (IPv4 and IPv6) endpoints."`
+}
+
+// urls returns the endpoint URLs by yaml key
+func (e *EndpointsConfig) urls() map[string]string {
+	return map[string]string{
+		"servicequotas": e.ServiceQuotas,
+		"cloudwatch":    e.CloudWatch,
+		"sts":           e.STS,
+	}
+}
+
+// fipsState returns the FIPS endpoint state, unset keeps the SDK configuration
+func (e *EndpointsConfig) fipsState() aws.FIPSEndpointState {
+	if e == nil || e.FIPS == nil {
+		return aws.FIPSEndpointStateUnset
+	}
+	if *e.FIPS {
+		return aws.FIPSEndpointStateEnabled
+	}
+	return aws.FIPSEndpointStateDisabled
+}
+
+// dualStackState returns the dual-stack endpoint state, unset keeps the SDK configuration
+func (e *EndpointsConfig) dualStackState() aws.DualStackEndpointState {
+	if e == nil || e.DualStack == nil {
+		return aws.DualStackEndpointStateUnset
+	}
+	if *e.DualStack {
+		return aws.DualStackEndpointStateEnabled
+	}
+	return aws.DualStackEndpointStateDisabled
+}
+
+// baseEndpoint returns endpoint or nil when not overridden
+func baseEndpoint(endpoint string) *string {
+	if endpoint == "" {
+		return nil
+	}
+	return aws.String(endpoint)
+}
+
+// serviceQuotasOptions applies the overrides to Service Quotas clients
+func (e *EndpointsConfig) serviceQuotasOptions(o *sq.Options) {
+	if e == nil {
+		return
+	}
+	if endpoint := baseEndpoint(e.ServiceQuotas); endpoint != nil {
+		o.BaseEndpoint = endpoint
+	}
+	if state := e.fipsState(); state != aws.FIPSEndpointStateUnset {
+		o.EndpointOptions.UseFIPSEndpoint = state
+	}
+	if state := e.dualStackState(); state != aws.DualStackEndpointStateUnset {
+		o.EndpointOptions.UseDualStackEndpoint = state
+	}
+}
+
+// cloudWatchOptions applies the overrides to CloudWatch clients
+func (e *EndpointsConfig) cloudWatchOptions(o *cw.Options) {
+	if e == nil {
+		return
+	}
+	if endpoint := baseEndpoint(e.CloudWatch); endpoint != nil {
+		o.BaseEndpoint = endpoint
+	}
+	if state := e.fipsState(); state != aws.FIPSEndpointStateUnset {
+		o.EndpointOptions.UseFIPSEndpoint = state
+	}
+	if state := e.dualStackState(); state != aws.DualStackEndpointStateUnset {
+		o.EndpointOptions.UseDualStackEndpoint = state
+	}
+}
+
+// stsOptions applies the overrides to STS clients
+func (e *EndpointsConfig) stsOptions(o *sts.Options) {
+	if e == nil {
+		return
+	}
+	if endpoint := baseEndpoint(e.STS); endpoint != nil {
+		o.BaseEndpoint = endpoint
+	}
+	if state := e.fipsState(); state != aws.FIPSEndpointStateUnset {
+		o.EndpointOptions.UseFIPSEndpoint = state
+	}
+	if state := e.dualStackState(); state != aws.DualStackEndpointStateUnset {
+		o.EndpointOptions.UseDualStackEndpoint = state
+	}
+}
+
+// validateEndpointURL checks that endpoint is an absolute http(s) URL
+func validateEndpointURL(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("must be an http or https URL")
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package pkg
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	cw "github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	sq "github.com/aws/aws-sdk-go-v2/service/servicequotas"
+)
+
+func Test_parseQuotaConfig_Endpoints(t *testing.T) {
+	qcl, err := parseQuotaConfig([]byte(`endpoints:
+  sts: http://localhost:4566
+  dualStack: true
+jobs:
+  - serviceCode: ec2
+    regions: [us-west-2]
+    endpoints:
+      servicequotas: http://localhost:4567
+  - serviceCode: lambda
+    regions: [us-west-2]
+`))
+	if err != nil {
+		t.Fatalf("parseQuotaConfig() error = %v", err)
+	}
+	ec2 := qcl.Jobs[0].Endpoints
+	if ec2.STS != "http://localhost:4566" || ec2.ServiceQuotas != "http://localhost:4567" || ec2.DualStack == nil || !*ec2.DualStack {
+		t.Errorf("ec2 endpoints = %+v, want the top-level sts and dualStack with its servicequotas", ec2)
+	}
+	lambda := qcl.Jobs[1].Endpoints
+	if lambda == nil || lambda.STS != "http://localhost:4566" || lambda.ServiceQuotas != "" {
+		t.Errorf("lambda endpoints = %+v, want the top-level endpoints", lambda)
+	}
+}
+
+func TestEndpointsConfig_Options(t *testing.T) {
+	fips := true
+	e := &EndpointsConfig{ServiceQuotas: "http://localhost:4566", FIPS: &fips}
+
+	var sqOpts sq.Options
+	e.serviceQuotasOptions(&sqOpts)
+	if aws.ToString(sqOpts.BaseEndpoint) != "http://localhost:4566" || sqOpts.EndpointOptions.UseFIPSEndpoint != aws.FIPSEndpointStateEnabled {
+		t.Errorf("servicequotas options = %v, %v", aws.ToString(sqOpts.BaseEndpoint), sqOpts.EndpointOptions.UseFIPSEndpoint)
+	}
+	var cwOpts cw.Options
+	e.cloudWatchOptions(&cwOpts)
+	if cwOpts.BaseEndpoint != nil || cwOpts.EndpointOptions.UseDualStackEndpoint != aws.DualStackEndpointStateUnset {
+		t.Errorf("cloudwatch options = %v, %v, want unchanged", aws.ToString(cwOpts.BaseEndpoint), cwOpts.EndpointOptions.UseDualStackEndpoint)
+	}
+
+	// jobs without endpoints keep the SDK options
+	var nilEndpoints *EndpointsConfig
+	nilEndpoints.serviceQuotasOptions(&sqOpts)
+}
+
+func Test_getAWSAccountID_Endpoint(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprint(w, `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetCallerIdentityResult>
+    <Arn>arn:aws:iam::123456789012:user/test</Arn>
+    <UserId>AIDEXAMPLE</UserId>
+    <Account>123456789012</Account>
+  </GetCallerIdentityResult>
+</GetCallerIdentityResponse>`)
+	}))
+	defer server.Close()
+
+	cfg := aws.Config{Region: "us-east-1", Credentials: credentials.NewStaticCredentialsProvider("AKID", "secret", "")}
+	if got := getAWSAccountID(cfg, &EndpointsConfig{STS: server.URL}); got != "123456789012" {
+		t.Errorf("getAWSAccountID() = %q, want 123456789012", got)
+	}
+	if requests != 1 {
+		t.Errorf("%d requests to the STS endpoint, want 1", requests)
+	}
+}
@@ -0,0 +1,131 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// fileValuePrefix reads a value from a file, e.g. role: file:/run/secrets/role
+	fileValuePrefix = "file:"
+	// fileKeySuffix reads the value of a key from a file, e.g. externalId_file: /run/secrets/external-id
+	fileKeySuffix = "_file"
+)
+
+// envRegexp matches $$ (a literal $), ${VAR} and ${VAR:-default}
+var envRegexp = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expander expands the environment variables and file references in the values of a YAML document
+type expander struct {
+	lookupEnv func(key string) (string, bool)
+	readFile  func(name string) ([]byte, error)
+	errs      ConfigErrors
+}
+
+func newExpander() *expander {
+	return &expander{lookupEnv: os.LookupEnv, readFile: os.ReadFile}
+}
+
+// expand replaces the values of node and its children in place, problems are collected in errs
+func (e *expander) expand(node *yaml.Node) {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			e.expand(child)
+		}
+	case yaml.MappingNode:
+		keys := map[string]bool{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keys[node.Content[i].Value] = true
+		}
+		content := make([]*yaml.Node, 0, len(node.Content))
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			e.expand(value)
+			if strings.HasSuffix(key.Value, fileKeySuffix) && value.Kind == yaml.ScalarNode {
+				name := strings.TrimSuffix(key.Value, fileKeySuffix)
+				if keys[name] {
+					// the conflicting key is dropped to report the conflict only once
+					e.errs = append(e.errs, ConfigError{Line: key.Line, Msg: fmt.Sprintf("both %s and %s are set", name, key.Value)})
+					continue
+				}
+				key.Value = name
+				value.Value = e.file(value.Value, value.Line)
+				value.Tag = "!!str"
+			}
+			content = append(content, key, value)
+		}
+		node.Content = content
+	case yaml.ScalarNode:
+		e.scalar(node)
+	}
+}
+
+// scalar expands the environment variables of a value, then reads it from a file if it starts with fileValuePrefix
+func (e *expander) scalar(node *yaml.Node) {
+	if !strings.Contains(node.Value, "$") && !strings.HasPrefix(node.Value, fileValuePrefix) {
+		return
+	}
+	value := envRegexp.ReplaceAllStringFunc(node.Value, func(match string) string {
+		if match == "$$" {
+			return "$"
+		}
+		m := envRegexp.FindStringSubmatch(match)
+		if v, ok := e.lookupEnv(m[1]); ok && (v != "" || m[2] == "") {
+			return v
+		}
+		if m[2] != "" {
+			return m[3]
+		}
+		e.errs = append(e.errs, ConfigError{Line: node.Line, Msg: fmt.Sprintf("environment variable %s is not set and has no default (use ${%s:-default})", m[1], m[1])})
+		return ""
+	})
+	if strings.HasPrefix(value, fileValuePrefix) {
+		value = e.file(strings.TrimPrefix(value, fileValuePrefix), node.Line)
+		node.Tag = "!!str"
+	} else if node.Style == 0 {
+		// plain values are resolved again, e.g. collectUsage: ${COLLECT_USAGE:-true}
+		node.Tag = ""
+	}
+	node.Value = value
+}
+
+// file returns the content of a secret file without its trailing newlines
+func (e *expander) file(name string, line int) string {
+	data, err := e.readFile(name)
+	if err != nil {
+		e.errs = append(e.errs, ConfigError{Line: line, Msg: fmt.Sprintf("failed to read value from file: %s", err)})
+		return ""
+	}
+	return strings.TrimRight(string(data), "\r\n")
+}
+
+// expandConfig expands root in place and returns it encoded, with the line of every encoded node mapped to its line in root
+func expandConfig(root *yaml.Node, e *expander) ([]byte, map[int]int, error) {
+	e.expand(root)
+	data, err := yaml.Marshal(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	var encoded yaml.Node
+	if err := yaml.Unmarshal(data, &encoded); err != nil {
+		return nil, nil, err
+	}
+	lines := map[int]int{}
+	mapLines(root, &encoded, lines)
+	return data, lines, nil
+}
+
+// mapLines maps the lines of the nodes of encoded to the lines of the same nodes in original
+func mapLines(original, encoded *yaml.Node, lines map[int]int) {
+	if _, ok := lines[encoded.Line]; !ok {
+		lines[encoded.Line] = original.Line
+	}
+	for i := 0; i < len(original.Content) && i < len(encoded.Content); i++ {
+		mapLines(original.Content[i], encoded.Content[i], lines)
+	}
+}
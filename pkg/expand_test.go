@@ -0,0 +1,75 @@
+package pkg
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_parseQuotaConfig_Expansion(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "external-id")
+	if err := os.WriteFile(secret, []byte("s3cr3t\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	role := filepath.Join(t.TempDir(), "role")
+	if err := os.WriteFile(role, []byte("arn:aws:iam::111111111111:role/quota-reader"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AQE_ACCOUNT_ID", "111111111111")
+	t.Setenv("AQE_COLLECT_USAGE", "true")
+	t.Setenv("AQE_EMPTY", "")
+	t.Setenv("AQE_ROLE_FILE", role)
+
+	qcl, err := parseQuotaConfig([]byte(`jobs:
+  - serviceCode: ec2
+    regions: ["${AQE_REGION:-us-west-2}"]
+    accountName: ${AQE_EMPTY:-default}-$${literal}
+    collectUsage: ${AQE_COLLECT_USAGE}
+    role: arn:aws:iam::${AQE_ACCOUNT_ID}:role/quota-reader
+    externalId_file: ` + secret + `
+  - serviceCode: lambda
+    regions: [us-west-2]
+    role: file:${AQE_ROLE_FILE}
+`))
+	if err != nil {
+		t.Fatalf("parseQuotaConfig() error = %v", err)
+	}
+	ec2 := qcl.Jobs[0]
+	got := []interface{}{ec2.Regions, ec2.AccountName, ec2.GetCollectUsage(false), ec2.Role, ec2.ExternalID}
+	want := []interface{}{[]string{"us-west-2"}, "default-${literal}", true, "arn:aws:iam::111111111111:role/quota-reader", "s3cr3t"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ec2 job = %v, want %v", got, want)
+	}
+	if qcl.Jobs[1].Role != "arn:aws:iam::111111111111:role/quota-reader" {
+		t.Errorf("lambda role = %q, want the content of the file", qcl.Jobs[1].Role)
+	}
+}
+
+func Test_parseQuotaConfig_ExpansionErrors(t *testing.T) {
+	_, err := parseQuotaConfig([]byte(`jobs:
+  - serviceCode: ec2
+    regions: [us-west-2]
+    role: arn:aws:iam::${AQE_UNSET_ACCOUNT_ID}:role/quota-reader
+    externalId: secret
+    externalId_file: /run/secrets/external-id
+  - serviceCode: lambda
+    regions: [us-west-2]
+    collectUsage: ${AQE_UNSET_BOOL:-maybe}
+    role: file:/nonexistent/role
+`))
+	var got ConfigErrors
+	if !errors.As(err, &got) {
+		t.Fatalf("parseQuotaConfig() error = %v, want ConfigErrors", err)
+	}
+	want := ConfigErrors{
+		{Line: 4, Msg: "environment variable AQE_UNSET_ACCOUNT_ID is not set and has no default (use ${AQE_UNSET_ACCOUNT_ID:-default})"},
+		{Line: 6, Msg: "both externalId and externalId_file are set"},
+		{Line: 9, Msg: "cannot unmarshal !!str `maybe` into bool"},
+		{Line: 10, Msg: "failed to read value from file: open /nonexistent/role: no such file or directory"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseQuotaConfig() errors = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,127 @@
+package pkg
+
+import (
+	"fmt"
+	"regexp"
+
+	sqTypes "github.com/aws/aws-sdk-go-v2/service/servicequotas/types"
+)
+
+// QuotaFilter matches quotas of a job. A quota matches when every field that is set matches.
+type QuotaFilter struct {
+	QuotaCode   string `yaml:"quotaCode,omitempty" description:"Quota code, glob pattern or /regex/."`
+	QuotaName   string `yaml:"quotaName,omitempty" description:"Regular expression matched against the quota name."`
+	Adjustable  *bool  `yaml:"adjustable,omitempty" description:"Match adjustable quotas (true) or fixed quotas (false)."`
+	GlobalQuota *bool  `yaml:"globalQuota,omitempty" description:"Match global quotas (true) or regional quotas (false)."`
+}
+
+// quotaFilter keeps the quotas matching any include rule (all quotas when there are none)
+// and not matching any exclude rule
+type quotaFilter struct {
+	include []compiledQuotaFilter
+	exclude []compiledQuotaFilter
+}
+
+type compiledQuotaFilter struct {
+	QuotaFilter
+	quotaCode *pattern
+	quotaName *regexp.Regexp
+}
+
+// newQuotaFilter compiles the include and exclude rules of a job
+func newQuotaFilter(include, exclude []QuotaFilter) (*quotaFilter, error) {
+	f := &quotaFilter{}
+	var err error
+	if f.include, err = compileQuotaFilters(include); err != nil {
+		return nil, fmt.Errorf("invalid include rule: %w", err)
+	}
+	if f.exclude, err = compileQuotaFilters(exclude); err != nil {
+		return nil, fmt.Errorf("invalid exclude rule: %w", err)
+	}
+	return f, nil
+}
+
+func compileQuotaFilters(filters []QuotaFilter) ([]compiledQuotaFilter, error) {
+	compiled := []compiledQuotaFilter{}
+	for _, filter := range filters {
+		c := compiledQuotaFilter{QuotaFilter: filter}
+		if filter.QuotaCode != "" {
+			p, err := compilePattern(filter.QuotaCode)
+			if err != nil {
+				return nil, err
+			}
+			c.quotaCode = p
+		}
+		if filter.QuotaName != "" {
+			re, err := regexp.Compile(filter.QuotaName)
+			if err != nil {
+				return nil, err
+			}
+			c.quotaName = re
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+// Filter returns the quotas kept by the filter
+func (f *quotaFilter) Filter(quotas []sqTypes.ServiceQuota) []sqTypes.ServiceQuota {
+	if f == nil || (len(f.include) == 0 && len(f.exclude) == 0) {
+		return quotas
+	}
+	filtered := []sqTypes.ServiceQuota{}
+	for _, q := range quotas {
+		if f.keeps(q) {
+			filtered = append(filtered, q)
+		}
+	}
+	return filtered
+}
+
+// FilterRequests returns the quota increase requests of the quotas kept by the filter
+func (f *quotaFilter) FilterRequests(requests []sqTypes.RequestedServiceQuotaChange) []sqTypes.RequestedServiceQuotaChange {
+	if f == nil || (len(f.include) == 0 && len(f.exclude) == 0) {
+		return requests
+	}
+	filtered := []sqTypes.RequestedServiceQuotaChange{}
+	for _, r := range requests {
+		// only adjustable quotas can be requested
+		q := sqTypes.ServiceQuota{QuotaCode: r.QuotaCode, QuotaName: r.QuotaName, GlobalQuota: r.GlobalQuota, Adjustable: true}
+		if f.keeps(q) {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered
+}
+
+func (f *quotaFilter) keeps(q sqTypes.ServiceQuota) bool {
+	if len(f.include) > 0 && !matchAny(f.include, q) {
+		return false
+	}
+	return !matchAny(f.exclude, q)
+}
+
+func matchAny(filters []compiledQuotaFilter, q sqTypes.ServiceQuota) bool {
+	for _, filter := range filters {
+		if filter.matches(q) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c compiledQuotaFilter) matches(q sqTypes.ServiceQuota) bool {
+	if c.quotaCode != nil && (q.QuotaCode == nil || !c.quotaCode.match(*q.QuotaCode)) {
+		return false
+	}
+	if c.quotaName != nil && (q.QuotaName == nil || !c.quotaName.MatchString(*q.QuotaName)) {
+		return false
+	}
+	if c.Adjustable != nil && *c.Adjustable != q.Adjustable {
+		return false
+	}
+	if c.GlobalQuota != nil && *c.GlobalQuota != q.GlobalQuota {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,96 @@
+package pkg
+
+import (
+	"reflect"
+	"testing"
+
+	sqTypes "github.com/aws/aws-sdk-go-v2/service/servicequotas/types"
+)
+
+func TestQuotaFilter_Filter(t *testing.T) {
+	quotas := []sqTypes.ServiceQuota{
+		{QuotaCode: Ptr("L-1216C47A"), QuotaName: Ptr("Running On-Demand Standard (A, C, D, H, I, M, R, T, Z) instances"), Adjustable: true},
+		{QuotaCode: Ptr("L-34B43A08"), QuotaName: Ptr("All Standard (A, C, D, H, I, M, R, T, Z) Spot Instance Requests"), Adjustable: true},
+		{QuotaCode: Ptr("L-0263D0A3"), QuotaName: Ptr("EC2-VPC Elastic IPs"), Adjustable: true},
+		{QuotaCode: Ptr("L-B665C33B"), QuotaName: Ptr("Attachments per transit gateway"), Adjustable: false, GlobalQuota: true},
+	}
+	codes := func(quotas []sqTypes.ServiceQuota) []string {
+		result := []string{}
+		for _, q := range quotas {
+			result = append(result, *q.QuotaCode)
+		}
+		return result
+	}
+	tests := []struct {
+		name    string
+		include []QuotaFilter
+		exclude []QuotaFilter
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "no rules",
+			want: []string{"L-1216C47A", "L-34B43A08", "L-0263D0A3", "L-B665C33B"},
+		},
+		{
+			name:    "include quota codes",
+			include: []QuotaFilter{{QuotaCode: "L-1216C47A"}, {QuotaCode: "L-0263D0A3"}},
+			want:    []string{"L-1216C47A", "L-0263D0A3"},
+		},
+		{
+			name:    "include quota name regex",
+			include: []QuotaFilter{{QuotaName: "(?i)spot|on-demand"}},
+			want:    []string{"L-1216C47A", "L-34B43A08"},
+		},
+		{
+			name:    "exclude fixed and global quotas",
+			exclude: []QuotaFilter{{Adjustable: Ptr(false)}, {GlobalQuota: Ptr(true)}},
+			want:    []string{"L-1216C47A", "L-34B43A08", "L-0263D0A3"},
+		},
+		{
+			name:    "include and exclude",
+			include: []QuotaFilter{{QuotaName: "Standard", Adjustable: Ptr(true)}},
+			exclude: []QuotaFilter{{QuotaCode: "L-34*"}},
+			want:    []string{"L-1216C47A"},
+		},
+		{
+			name:    "invalid quota name regex",
+			include: []QuotaFilter{{QuotaName: "("}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newQuotaFilter(tt.include, tt.exclude)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newQuotaFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := codes(f.Filter(quotas)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Filter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuotaFilter_FilterRequests(t *testing.T) {
+	requests := []sqTypes.RequestedServiceQuotaChange{
+		{QuotaCode: Ptr("L-1216C47A"), QuotaName: Ptr("Running On-Demand Standard (A, C, D, H, I, M, R, T, Z) instances")},
+		{QuotaCode: Ptr("L-0263D0A3"), QuotaName: Ptr("EC2-VPC Elastic IPs")},
+	}
+	filter, err := newQuotaFilter([]QuotaFilter{{QuotaCode: "/^L-(1216C47A|0263D0A3)$/"}}, []QuotaFilter{{QuotaName: "Elastic IPs"}})
+	if err != nil {
+		t.Fatalf("newQuotaFilter() error = %v", err)
+	}
+	got := filter.FilterRequests(requests)
+	if len(got) != 1 || *got[0].QuotaCode != "L-1216C47A" {
+		t.Errorf("FilterRequests() = %v, want L-1216C47A", got)
+	}
+	// requested quotas are adjustable
+	filter, _ = newQuotaFilter([]QuotaFilter{{Adjustable: Ptr(true)}}, nil)
+	if got := filter.FilterRequests(requests); !reflect.DeepEqual(got, requests) {
+		t.Errorf("FilterRequests() = %v, want every request", got)
+	}
+}
@@ -0,0 +1,54 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// configFragmentPattern selects the files of a configuration directory
+const configFragmentPattern = "*.yml"
+
+// configFragment is one file of the configuration
+type configFragment struct {
+	file   string
+	data   []byte
+	remote bool // fetched over http or s3, ${VAR} and file references are not expanded
+}
+
+// jobPosition is where a job is defined
+type jobPosition struct {
+	file string
+	line int
+}
+
+// configFiles returns the files of configFile: the *.yml files of a directory,
+// the files matching a glob pattern or the file itself, in lexical order
+func configFiles(configFile string) ([]string, error) {
+	pattern := configFile
+	if info, err := os.Stat(configFile); err == nil {
+		if !info.IsDir() {
+			return []string{configFile}, nil
+		}
+		pattern = filepath.Join(configFile, configFragmentPattern)
+	} else if !strings.ContainsAny(configFile, "*?[") {
+		return nil, err
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && !info.IsDir() {
+			files = append(files, match)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no configuration files match %s", pattern)
+	}
+	sort.Strings(files)
+	return files, nil
+}
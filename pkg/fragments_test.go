@@ -0,0 +1,159 @@
+package pkg
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestNewQuotaConfig_Fragments(t *testing.T) {
+	dir := t.TempDir()
+	teamA := filepath.Join(dir, "team-a.yml")
+	teamB := filepath.Join(dir, "team-b.yml")
+	writeConfig(t, teamA, "defaults:\n  regions: [us-west-2]\njobs:\n  - serviceCode: lambda\n")
+	writeConfig(t, teamB, "jobs:\n  - serviceCode: ec2\n    regions: [us-east-1]\n")
+	writeConfig(t, filepath.Join(dir, "README.md"), "not a configuration file")
+	if err := os.Mkdir(filepath.Join(dir, "old.yml"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, configFile := range []string{dir, filepath.Join(dir, "team-*.yml")} {
+		t.Run(configFile, func(t *testing.T) {
+			qcl, err := NewQuotaConfig(configFile)
+			if err != nil {
+				t.Fatalf("NewQuotaConfig() error = %v", err)
+			}
+			want := []JobConfig{
+				{ServiceCode: "lambda", Regions: []string{"us-west-2"}, Source: teamA},
+				{ServiceCode: "ec2", Regions: []string{"us-east-1"}, Source: teamB},
+			}
+			if !reflect.DeepEqual(qcl.Jobs, want) {
+				t.Errorf("NewQuotaConfig() jobs = %v, want %v", qcl.Jobs, want)
+			}
+		})
+	}
+
+	if _, err := NewQuotaConfig(filepath.Join(dir, "*.yaml")); err == nil {
+		t.Error("NewQuotaConfig() expected an error when no file matches")
+	}
+}
+
+func TestNewQuotaConfig_FragmentDefaults(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, filepath.Join(dir, "00-defaults.yml"), `defaults:
+  regions: [us-west-2]
+  labels:
+    env: prod
+endpoints:
+  cloudwatch: https://monitoring.us-west-2.amazonaws.com
+relabelConfigs:
+  - action: labeldrop
+    regex: global_quota
+`)
+	jobs := filepath.Join(dir, "10-jobs.yml")
+	writeConfig(t, jobs, "jobs:\n  - serviceCode: lambda\n")
+	// the same value in two files is not a conflict
+	writeConfig(t, filepath.Join(dir, "20-team.yml"), "defaults:\n  labels:\n    env: prod\n    team: platform\n")
+
+	qcl, err := NewQuotaConfig(dir)
+	if err != nil {
+		t.Fatalf("NewQuotaConfig() error = %v", err)
+	}
+	want := []JobConfig{{
+		ServiceCode:    "lambda",
+		Regions:        []string{"us-west-2"},
+		Labels:         map[string]string{"env": "prod", "team": "platform"},
+		Endpoints:      &EndpointsConfig{CloudWatch: "https://monitoring.us-west-2.amazonaws.com"},
+		RelabelConfigs: []RelabelConfig{{Action: RelabelLabelDrop, Regex: "global_quota"}},
+		Source:         jobs,
+	}}
+	if !reflect.DeepEqual(qcl.Jobs, want) {
+		t.Errorf("NewQuotaConfig() jobs = %+v, want %+v", qcl.Jobs, want)
+	}
+}
+
+func TestNewQuotaConfig_FragmentDefaultsConflict(t *testing.T) {
+	dir := t.TempDir()
+	shared := filepath.Join(dir, "00-defaults.yml")
+	team := filepath.Join(dir, "10-team.yml")
+	writeConfig(t, shared, "defaults:\n  regions: [us-west-2]\n  labels:\n    env: prod\nendpoints:\n  sts: https://sts.us-west-2.amazonaws.com\n")
+	writeConfig(t, team, `endpoints:
+  sts: https://sts.eu-west-1.amazonaws.com
+defaults:
+  regions: [eu-west-1]
+  labels:
+    env: prod
+    team: platform
+jobs:
+  - serviceCode: lambda
+`)
+
+	_, err := NewQuotaConfig(dir)
+	var got ConfigErrors
+	if !errors.As(err, &got) {
+		t.Fatalf("NewQuotaConfig() error = %v, want ConfigErrors", err)
+	}
+	want := ConfigErrors{
+		{File: team, Line: 2, Msg: "defaults endpoints.sts conflicts with the defaults of " + shared},
+		{File: team, Line: 4, Msg: "defaults regions conflicts with the defaults of " + shared},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NewQuotaConfig() errors = %v, want %v", got, want)
+	}
+}
+
+func TestNewQuotaConfig_FragmentErrors(t *testing.T) {
+	dir := t.TempDir()
+	teamA := filepath.Join(dir, "a.yml")
+	teamB := filepath.Join(dir, "b.yml")
+	writeConfig(t, teamA, "jobs:\n  - serviceCode: lambda\n    regions: [us-west-2]\n")
+	writeConfig(t, teamB, "jobs:\n  - serviceCode: ec2\n    regions: [us-west-2, useast1]\n  - serviceCode: lambda\n    regions: [us-west-2]\n")
+
+	_, err := NewQuotaConfig(dir)
+	var got ConfigErrors
+	if !errors.As(err, &got) {
+		t.Fatalf("NewQuotaConfig() error = %v, want ConfigErrors", err)
+	}
+	want := ConfigErrors{
+		{File: teamB, Line: 3, Msg: `invalid region "useast1", must match ^(\*|[a-z]{2}(-[a-z]+)?-[a-z]+-[0-9]+)$`},
+		{File: teamB, Line: 5, Msg: `duplicate job for serviceCode "lambda", region "us-west-2" and role "" (first defined at ` + teamA + `:3)`},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NewQuotaConfig() errors = %v, want %v", got, want)
+	}
+}
+
+func TestReloader_FragmentMetrics(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, filepath.Join(dir, "a.yml"), "jobs:\n  - serviceCode: lambda\n    regions: [us-west-2]\n")
+	writeConfig(t, filepath.Join(dir, "b.yml"), "jobs:\n  - serviceCode: ec2\n    regions: [us-west-2]\n")
+	r := NewReloader(dir, func(job JobConfig) prometheus.Collector {
+		return NewPrometheusCollector(func() ([]*PrometheusMetric, error) { return nil, nil })
+	})
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	metrics, _ := r.Metrics()
+	files := map[string]string{}
+	for _, m := range metrics {
+		if m.Name == "aqe_config_job_info" {
+			files[m.Labels["service_code"]] = m.Labels["file"]
+		}
+	}
+	want := map[string]string{"lambda": filepath.Join(dir, "a.yml"), "ec2": filepath.Join(dir, "b.yml")}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("aqe_config_job_info files = %v, want %v", files, want)
+	}
+
+	// a change in any file is detected
+	before, _ := configChecksum(dir)
+	writeConfig(t, filepath.Join(dir, "b.yml"), "jobs:\n  - serviceCode: ec2\n    regions: [us-east-1]\n")
+	if after, _ := configChecksum(dir); after == before {
+		t.Error("configChecksum() unchanged after a file changed")
+	}
+}
@@ -19,15 +19,19 @@ type MetricGroup struct {
 	Sim    float64              `json:"sim,omitempty"`    // Similarity score.
 	Quota  sqTypes.ServiceQuota `json:"quota,omitempty"`  // AWS service quota.
 	Usage  float64              `json:"usage,omitempty"`  // AWS service quota usage.
+	// AWS default value of the quota, nil when unknown.
+	Default *float64 `json:"default,omitempty"`
 }
 
 // Grouping represents a Grouping instance.
 type Grouping struct {
-	maxSimilarity float64        // Maximum similarity score.
-	region        string         // AWS region.
-	account       string         // AWS account.
-	accountName   string         // AWS account name.
-	repl          *regexp.Regexp // Regular expression for replacing patterns.
+	maxSimilarity float64                // Maximum similarity score.
+	region        string                 // AWS region.
+	account       string                 // AWS account.
+	accountName   string                 // AWS account name.
+	labels        map[string]string      // Static labels of the job.
+	metricNames   map[string]QuotaMetric // Fixed metric names of the job.
+	repl          *regexp.Regexp         // Regular expression for replacing patterns.
 }
 
 // NewGrouping initializes a new grouping instance.
@@ -37,6 +41,8 @@ func NewGrouping(maxSimilarity float64, jobRegionCfg JobRegion) *Grouping {
 		region:        jobRegionCfg.Region,
 		account:       jobRegionCfg.AccountID,
 		accountName:   jobRegionCfg.AccountName,
+		labels:        jobRegionCfg.Labels,
+		metricNames:   jobRegionCfg.MetricNames,
 		repl:          regexp.MustCompile(` \(.*\)`),
 	}
 }
@@ -73,14 +79,10 @@ func (g *Grouping) common(a, b string) string {
 
 // createPromMetric creates a Prometheus metric based on the given metric group and type.
 func (g *Grouping) createPromMetric(m MetricGroup, metricType string) *PrometheusMetric {
-	value := *m.Quota.Value
-	if metricType == "usage" {
-		value = m.Usage
-	}
-	return &PrometheusMetric{
+	return withMetricName(&PrometheusMetric{
 		Name:  createMetricName(*m.Quota.ServiceCode, m.Common),
-		Value: value,
-		Labels: map[string]string{
+		Value: m.value(metricType),
+		Labels: withJobLabels(map[string]string{
 			"type":         metricType,
 			"adjustable":   strconv.FormatBool(m.Quota.Adjustable),
 			"global_quota": strconv.FormatBool(m.Quota.GlobalQuota),
@@ -92,9 +94,20 @@ func (g *Grouping) createPromMetric(m MetricGroup, metricType string) *Prometheu
 			"name":         *m.Quota.QuotaName,
 			"quota_code":   *m.Quota.QuotaCode,
 			"service_code": *m.Quota.ServiceCode,
-		},
+		}, g.labels),
 		Desc: createDescription(*m.Quota.ServiceName, m.Common),
+	}, m.Quota, g.metricNames)
+}
+
+// value returns the value of the metric of type metricType (quota, usage or default)
+func (m MetricGroup) value(metricType string) float64 {
+	switch metricType {
+	case "usage":
+		return m.Usage
+	case "default":
+		return *m.Default
 	}
+	return *m.Quota.Value
 }
 
 // RemoveBrackets removes brackets from metric names.
@@ -116,13 +129,13 @@ func (g *Grouping) GroupMetrics(quotas []QuotaUsage, collectUsage bool) (map[str
 		}
 		check[*q.Quota.QuotaName] = true
 		if len(response) == 0 {
-			response[*q.Quota.QuotaName] = []MetricGroup{{Quota: q.Quota, Usage: q.Usage}}
+			response[*q.Quota.QuotaName] = []MetricGroup{{Quota: q.Quota, Usage: q.Usage, Default: q.Default}}
 		} else {
 			selected := false
 			for key := range response {
 				sim := hem.Compare(g.RemoveBrackets(*q.Quota.QuotaName), g.RemoveBrackets(key))
 				if sim >= g.maxSimilarity {
-					response[key] = append(response[key], MetricGroup{Quota: q.Quota, Usage: q.Usage})
+					response[key] = append(response[key], MetricGroup{Quota: q.Quota, Usage: q.Usage, Default: q.Default})
 					if len(response[key]) == 2 {
 						commonStr := g.common(*response[key][0].Quota.QuotaName, *response[key][1].Quota.QuotaName)
 						if commonStr == "" || len(strings.Split(commonStr, " ")) <= 2 { // if the first words of metric names are not the same or common is only two words then skip
@@ -137,6 +150,9 @@ func (g *Grouping) GroupMetrics(quotas []QuotaUsage, collectUsage bool) (map[str
 							if collectUsage && response[key][i].Quota.UsageMetric != nil { // add Usage metric if Quota has UsageMetric
 								promMetrics = append(promMetrics, g.createPromMetric(response[key][i], "usage"))
 							}
+							if response[key][i].Default != nil { // add the AWS default value of the quota
+								promMetrics = append(promMetrics, g.createPromMetric(response[key][i], "default"))
+							}
 						}
 					} else if len(response[key]) > 2 {
 						_id := len(response[key]) - 1
@@ -150,13 +166,16 @@ func (g *Grouping) GroupMetrics(quotas []QuotaUsage, collectUsage bool) (map[str
 						if collectUsage && response[key][_id].Quota.UsageMetric != nil { // add Usage metric if Quota has UsageMetric
 							promMetrics = append(promMetrics, g.createPromMetric(response[key][_id], "usage"))
 						}
+						if response[key][_id].Default != nil { // add the AWS default value of the quota
+							promMetrics = append(promMetrics, g.createPromMetric(response[key][_id], "default"))
+						}
 					}
 					selected = true
 					break
 				}
 			}
 			if !selected {
-				response[*q.Quota.QuotaName] = []MetricGroup{{Quota: q.Quota, Usage: q.Usage}}
+				response[*q.Quota.QuotaName] = []MetricGroup{{Quota: q.Quota, Usage: q.Usage, Default: q.Default}}
 			}
 		}
 	}
@@ -0,0 +1,228 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// AWS retry modes of the SDK
+const (
+	RetryModeStandard = string(aws.RetryModeStandard)
+	RetryModeAdaptive = string(aws.RetryModeAdaptive)
+)
+
+// APILimits limits the calls of every AWS API (e.g. ServiceQuotas ListServiceQuotas) of every account.
+// Limits set to 0 are disabled.
+type APILimits struct {
+	Rate           float64 // calls per second
+	Burst          int     // calls allowed at once above the rate, 1 when not set
+	MaxConcurrency int     // calls in flight
+	RetryMode      string  // standard or adaptive
+	MaxAttempts    int     // attempts of a call, including the first one
+}
+
+// apiLimiter holds the token buckets and concurrency slots by account and API, and the retryers by account
+type apiLimiter struct {
+	limits   APILimits
+	mutex    *sync.Mutex
+	buckets  map[string]*tokenBucket
+	slots    map[string]chan struct{}
+	retryers map[string]aws.Retryer
+}
+
+func newAPILimiter(limits APILimits) *apiLimiter {
+	return &apiLimiter{
+		limits:   limits,
+		mutex:    new(sync.Mutex),
+		buckets:  map[string]*tokenBucket{},
+		slots:    map[string]chan struct{}{},
+		retryers: map[string]aws.Retryer{},
+	}
+}
+
+// validate checks the limits, the zero APILimits is valid
+func (l APILimits) validate() error {
+	if l.Rate < 0 || l.Burst < 0 || l.MaxConcurrency < 0 || l.MaxAttempts < 0 {
+		return fmt.Errorf("AWS API limits must not be negative")
+	}
+	switch l.RetryMode {
+	case "", RetryModeStandard, RetryModeAdaptive:
+	default:
+		return fmt.Errorf("invalid retry mode %q, must be one of %q or %q", l.RetryMode, RetryModeStandard, RetryModeAdaptive)
+	}
+	return nil
+}
+
+// newRetryer returns the retryer of the calls made with cfg. The retry mode and max attempts
+// resolved by cfg (AWS_RETRY_MODE, AWS_MAX_ATTEMPTS or the profile) are kept unless the limits set them.
+func (l APILimits) newRetryer(cfg aws.Config) aws.Retryer {
+	mode := aws.RetryMode(l.RetryMode)
+	if mode == "" {
+		mode = cfg.RetryMode
+	}
+	standardOptions := func(o *retry.StandardOptions) {
+		if cfg.RetryMaxAttempts > 0 {
+			o.MaxAttempts = cfg.RetryMaxAttempts
+		}
+	}
+	var retryer aws.Retryer
+	if mode == aws.RetryModeAdaptive {
+		retryer = retry.NewAdaptiveMode(func(o *retry.AdaptiveModeOptions) {
+			o.StandardOptions = append(o.StandardOptions, standardOptions)
+		})
+	} else {
+		retryer = retry.NewStandard(standardOptions)
+	}
+	if l.MaxAttempts > 0 {
+		retryer = retry.AddWithMaxAttempts(retryer, l.MaxAttempts)
+	}
+	return retryer
+}
+
+// retryer returns the retryer of account, created on first use with cfg. It is shared by
+// the clients and the jobs of the account so that the adaptive mode keeps its rate between scrapes.
+func (l *apiLimiter) retryer(cfg aws.Config, account string) aws.Retryer {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	retryer, ok := l.retryers[account]
+	if !ok {
+		retryer = l.limits.newRetryer(cfg)
+		l.retryers[account] = retryer
+	}
+	return retryer
+}
+
+// withAPILimits returns cfg with the retryer and the limits of the calls of account
+func (l *apiLimiter) withAPILimits(cfg aws.Config, account string) aws.Config {
+	if l == nil {
+		return cfg
+	}
+	if l.limits.RetryMode != "" || l.limits.MaxAttempts > 0 {
+		retryer := l.retryer(cfg, account)
+		cfg.Retryer = func() aws.Retryer { return retryer }
+	}
+	cfg.APIOptions = append(append([]func(*middleware.Stack) error{}, cfg.APIOptions...), func(stack *middleware.Stack) error {
+		if err := stack.Initialize.Add(attemptsMiddleware(), middleware.After); err != nil {
+			return err
+		}
+		// added after the retry middleware to limit and count every attempt
+		return stack.Finalize.Add(l.attemptMiddleware(account), middleware.After)
+	})
+	return cfg
+}
+
+// attemptsKey is the stack value counting the attempts of a call
+type attemptsKey struct{}
+
+// attemptsMiddleware counts the attempts of a call, to count the retries
+func attemptsMiddleware() middleware.InitializeMiddleware {
+	return middleware.InitializeMiddlewareFunc("AQEAttempts", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		return next.HandleInitialize(middleware.WithStackValue(ctx, attemptsKey{}, new(int)), in)
+	})
+}
+
+// attemptMiddleware waits for the rate and concurrency limits of the API of the call,
+// and counts the retries and throttled attempts
+func (l *apiLimiter) attemptMiddleware(account string) middleware.FinalizeMiddleware {
+	throttles := retry.IsErrorThrottles(retry.DefaultThrottles)
+	return middleware.FinalizeMiddlewareFunc("AQEAPILimits", func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+		service, operation := awsmiddleware.GetServiceID(ctx), awsmiddleware.GetOperationName(ctx)
+		if attempts, ok := middleware.GetStackValue(ctx, attemptsKey{}).(*int); ok {
+			*attempts++
+			if *attempts > 1 {
+				awsRetries.WithLabelValues(service, operation, account).Inc()
+			}
+		}
+
+		release, err := l.acquire(ctx, account+"/"+service+"/"+operation)
+		if err != nil {
+			return middleware.FinalizeOutput{}, middleware.Metadata{}, err
+		}
+		out, metadata, err := next.HandleFinalize(ctx, in)
+		release()
+		if err != nil && throttles.IsErrorThrottle(err) == aws.TrueTernary {
+			awsThrottles.WithLabelValues(service, operation, account).Inc()
+		}
+		return out, metadata, err
+	})
+}
+
+// acquire waits for a token of the bucket and a concurrency slot of key, release frees the slot
+func (l *apiLimiter) acquire(ctx context.Context, key string) (release func(), err error) {
+	l.mutex.Lock()
+	bucket, slots := l.buckets[key], l.slots[key]
+	if bucket == nil && l.limits.Rate > 0 {
+		bucket = newTokenBucket(l.limits.Rate, l.limits.Burst)
+		l.buckets[key] = bucket
+	}
+	if slots == nil && l.limits.MaxConcurrency > 0 {
+		slots = make(chan struct{}, l.limits.MaxConcurrency)
+		l.slots[key] = slots
+	}
+	l.mutex.Unlock()
+
+	if bucket != nil {
+		if err := bucket.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// tokenBucket allows rate calls per second, with bursts of burst calls
+type tokenBucket struct {
+	mutex  *sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	b := &tokenBucket{mutex: new(sync.Mutex), rate: rate, burst: math.Max(float64(burst), 1), last: time.Now()}
+	b.tokens = b.burst
+	return b
+}
+
+// Wait takes a token, waiting until it is available or ctx is done
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	b.mutex.Lock()
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	// the token is reserved, the bucket goes below 0 while calls are waiting
+	b.tokens--
+	wait := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	b.mutex.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.mutex.Lock()
+		b.tokens++ // the reserved token is given back
+		b.mutex.Unlock()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,172 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	sq "github.com/aws/aws-sdk-go-v2/service/servicequotas"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestAPILimits_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  APILimits
+		wantErr bool
+	}{
+		{name: "disabled", limits: APILimits{}},
+		{name: "valid", limits: APILimits{Rate: 2.5, Burst: 5, MaxConcurrency: 2, RetryMode: RetryModeAdaptive, MaxAttempts: 5}},
+		{name: "negative", limits: APILimits{Rate: -1}, wantErr: true},
+		{name: "invalid retry mode", limits: APILimits{RetryMode: "legacy"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.limits.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAPILimits_newRetryer(t *testing.T) {
+	tests := []struct {
+		name            string
+		limits          APILimits
+		cfg             aws.Config
+		wantAdaptive    bool
+		wantMaxAttempts int
+	}{
+		{name: "limits", limits: APILimits{RetryMode: RetryModeAdaptive, MaxAttempts: 7}, wantAdaptive: true, wantMaxAttempts: 7},
+		{name: "retry mode", limits: APILimits{RetryMode: RetryModeAdaptive}, cfg: aws.Config{RetryMaxAttempts: 5}, wantAdaptive: true, wantMaxAttempts: 5},
+		{name: "max attempts keep the resolved retry mode", limits: APILimits{MaxAttempts: 7}, cfg: aws.Config{RetryMode: aws.RetryModeAdaptive}, wantAdaptive: true, wantMaxAttempts: 7},
+		{name: "max attempts", limits: APILimits{MaxAttempts: 7}, wantMaxAttempts: 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retryer := tt.limits.newRetryer(tt.cfg)
+			if retryer.MaxAttempts() != tt.wantMaxAttempts {
+				t.Errorf("MaxAttempts() = %d, want %d", retryer.MaxAttempts(), tt.wantMaxAttempts)
+			}
+			_, adaptive := unwrapRetryer(retryer).(*retry.AdaptiveMode)
+			if adaptive != tt.wantAdaptive {
+				t.Errorf("newRetryer() adaptive = %v, want %v", adaptive, tt.wantAdaptive)
+			}
+		})
+	}
+}
+
+// unwrapRetryer returns the retryer wrapped by retry.AddWithMaxAttempts
+func unwrapRetryer(retryer aws.Retryer) aws.Retryer {
+	if v := reflect.Indirect(reflect.ValueOf(retryer)); v.Kind() == reflect.Struct {
+		if wrapped := v.FieldByName("RetryerV2"); wrapped.IsValid() {
+			return wrapped.Interface().(aws.Retryer)
+		}
+	}
+	return retryer
+}
+
+func Test_apiLimiter_retryer(t *testing.T) {
+	l := newAPILimiter(APILimits{RetryMode: RetryModeAdaptive})
+	first := l.retryer(aws.Config{}, "111111111111")
+	if l.retryer(aws.Config{}, "111111111111") != first {
+		t.Error("retryer() of the same account is not shared")
+	}
+	if l.retryer(aws.Config{}, "222222222222") == first {
+		t.Error("retryer() of another account is shared")
+	}
+}
+
+func Test_tokenBucket(t *testing.T) {
+	b := newTokenBucket(20, 2)
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := b.Wait(context.Background()); err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+	}
+	// 2 calls at once, then one call every 50ms
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("4 calls in %s, want at least 100ms", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b = newTokenBucket(0.001, 1)
+	_ = b.Wait(ctx)
+	if err := b.Wait(ctx); err == nil {
+		t.Error("Wait() error = nil, want the error of the canceled context")
+	}
+}
+
+func Test_apiLimiter_acquire(t *testing.T) {
+	l := newAPILimiter(APILimits{MaxConcurrency: 1})
+	release, err := l.acquire(context.Background(), "111111111111/Service Quotas/ListServiceQuotas")
+	if err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+	// the other APIs and accounts have their own slots
+	if _, err := l.acquire(context.Background(), "222222222222/Service Quotas/ListServiceQuotas"); err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(ctx, "111111111111/Service Quotas/ListServiceQuotas"); err == nil {
+		t.Fatal("acquire() error = nil, want a timeout while the slot is used")
+	}
+	release()
+	if _, err := l.acquire(context.Background(), "111111111111/Service Quotas/ListServiceQuotas"); err != nil {
+		t.Errorf("acquire() error = %v after release", err)
+	}
+}
+
+func Test_apiLimiter_withAPILimits(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		if requests == 1 {
+			w.Header().Set("X-Amzn-Errortype", "TooManyRequestsException")
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"__type":"TooManyRequestsException","message":"Rate exceeded"}`)
+			return
+		}
+		fmt.Fprint(w, `{"Quotas":[]}`)
+	}))
+	defer server.Close()
+
+	cfg := aws.Config{Region: "us-east-1", Credentials: credentials.NewStaticCredentialsProvider("AKID", "secret", "")}
+	cfg = newAPILimiter(APILimits{Rate: 100, MaxConcurrency: 1, RetryMode: RetryModeStandard, MaxAttempts: 2}).withAPILimits(cfg, "111111111111")
+	noBackoff := retry.BackoffDelayerFunc(func(int, error) (time.Duration, error) { return 0, nil })
+	client := sq.NewFromConfig(cfg, func(o *sq.Options) {
+		o.BaseEndpoint = aws.String(server.URL)
+		if o.Retryer.MaxAttempts() != 2 {
+			t.Errorf("MaxAttempts() = %d, want 2", o.Retryer.MaxAttempts())
+		}
+		o.Retryer = retry.NewStandard(func(so *retry.StandardOptions) { so.MaxAttempts = 2; so.Backoff = noBackoff })
+	})
+
+	throttles := awsThrottles.WithLabelValues("Service Quotas", "ListServiceQuotas", "111111111111")
+	retries := awsRetries.WithLabelValues("Service Quotas", "ListServiceQuotas", "111111111111")
+	wantThrottles, wantRetries := testutil.ToFloat64(throttles)+1, testutil.ToFloat64(retries)+1
+	if _, err := client.ListServiceQuotas(context.Background(), &sq.ListServiceQuotasInput{ServiceCode: aws.String("ec2")}); err != nil {
+		t.Fatalf("ListServiceQuotas() error = %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("%d requests, want 2", requests)
+	}
+	if got := testutil.ToFloat64(throttles); got != wantThrottles {
+		t.Errorf("aqe_aws_api_throttles_total = %v, want %v", got, wantThrottles)
+	}
+	if got := testutil.ToFloat64(retries); got != wantRetries {
+		t.Errorf("aqe_aws_api_retries_total = %v, want %v", got, wantRetries)
+	}
+}
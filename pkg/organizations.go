@@ -0,0 +1,147 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	orgTypes "github.com/aws/aws-sdk-go-v2/service/organizations/types"
+)
+
+// ErrNoAccounts is returned when the accounts of an organization could not be resolved
+var ErrNoAccounts = errors.New("No accounts resolved")
+
+// OrganizationConfig discovers the accounts of a job from AWS Organizations.
+// Organizations is called from the management or a delegated-admin account,
+// with the default credentials or by assuming Role.
+type OrganizationConfig struct {
+	Role            string            `yaml:"role,omitempty" description:"Role assumed to call Organizations." title:"organization role ARN" pattern:"^arn:[a-z-]+:iam::[^:]*:role/.+$"`
+	RoleName        string            `yaml:"roleName,omitempty" description:"Role assumed in every account, the job role template is used when empty."`
+	OUs             []string          `yaml:"ous,omitempty" description:"Only accounts directly under these organizational units."`
+	Tags            map[string]string `yaml:"tags,omitempty" description:"Only accounts with all these tags."`
+	Status          []string          `yaml:"status,omitempty" description:"Only accounts with one of these statuses (default ACTIVE)." title:"account status" enum:"ACTIVE,SUSPENDED,PENDING_CLOSURE"`
+	ExcludeAccounts []string          `yaml:"excludeAccounts,omitempty" description:"Account ids removed from the discovered accounts." title:"account id" pattern:"^[0-9]{12}$"`
+}
+
+// OrganizationsClient interface for easier testing
+type OrganizationsClient interface {
+	ListAccounts(ctx context.Context, params *organizations.ListAccountsInput, optFns ...func(*organizations.Options)) (*organizations.ListAccountsOutput, error)
+	ListAccountsForParent(ctx context.Context, params *organizations.ListAccountsForParentInput, optFns ...func(*organizations.Options)) (*organizations.ListAccountsForParentOutput, error)
+	ListTagsForResource(ctx context.Context, params *organizations.ListTagsForResourceInput, optFns ...func(*organizations.Options)) (*organizations.ListTagsForResourceOutput, error)
+}
+
+// organizationAccount is an account discovered in the organization
+type organizationAccount struct {
+	AccountConfig
+	role string
+}
+
+// listOrganizationAccounts lists the accounts of the organization matching org and the role to assume in each of them
+func listOrganizationAccounts(ctx context.Context, client OrganizationsClient, region string, org OrganizationConfig, roleTemplate string) ([]organizationAccount, error) {
+	if region == "" {
+		region = discoveryRegion
+	}
+	opts := func(o *organizations.Options) { o.Region = region }
+	var accounts []orgTypes.Account
+	if len(org.OUs) == 0 {
+		input := &organizations.ListAccountsInput{}
+		for {
+			r, err := client.ListAccounts(ctx, input, opts)
+			if err != nil {
+				return nil, err
+			}
+			accounts = append(accounts, r.Accounts...)
+			if r.NextToken == nil {
+				break
+			}
+			input.NextToken = r.NextToken
+		}
+	}
+	for _, ou := range org.OUs {
+		input := &organizations.ListAccountsForParentInput{ParentId: aws.String(ou)}
+		for {
+			r, err := client.ListAccountsForParent(ctx, input, opts)
+			if err != nil {
+				return nil, err
+			}
+			accounts = append(accounts, r.Accounts...)
+			if r.NextToken == nil {
+				break
+			}
+			input.NextToken = r.NextToken
+		}
+	}
+
+	statuses := org.Status
+	if len(statuses) == 0 {
+		statuses = []string{string(orgTypes.AccountStatusActive)}
+	}
+	result := []organizationAccount{}
+	seen := map[string]bool{}
+	for _, account := range accounts {
+		id := aws.ToString(account.Id)
+		if seen[id] || !contains(statuses, string(account.Status)) || contains(org.ExcludeAccounts, id) {
+			continue
+		}
+		seen[id] = true
+		if len(org.Tags) > 0 {
+			ok, err := hasTags(ctx, client, opts, id, org.Tags)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		a := organizationAccount{AccountConfig: AccountConfig{ID: id, Name: aws.ToString(account.Name)}}
+		role, err := organizationRole(account, org.RoleName, roleTemplate, a.AccountConfig)
+		if err != nil {
+			return nil, err
+		}
+		a.role = role
+		result = append(result, a)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+// organizationRole returns the role to assume in account, in the partition of the organization
+func organizationRole(account orgTypes.Account, roleName, roleTemplate string, config AccountConfig) (string, error) {
+	if roleName == "" {
+		return renderRole(roleTemplate, config)
+	}
+	partition := "aws"
+	if a, err := arn.Parse(aws.ToString(account.Arn)); err == nil {
+		partition = a.Partition
+	}
+	return fmt.Sprintf("arn:%s:iam::%s:role/%s", partition, config.ID, roleName), nil
+}
+
+// hasTags returns true if the account has all the tags
+func hasTags(ctx context.Context, client OrganizationsClient, opts func(*organizations.Options), accountID string, tags map[string]string) (bool, error) {
+	found := map[string]string{}
+	input := &organizations.ListTagsForResourceInput{ResourceId: aws.String(accountID)}
+	for {
+		r, err := client.ListTagsForResource(ctx, input, opts)
+		if err != nil {
+			return false, err
+		}
+		for _, tag := range r.Tags {
+			found[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+		}
+		if r.NextToken == nil {
+			break
+		}
+		input.NextToken = r.NextToken
+	}
+	for k, v := range tags {
+		if value, ok := found[k]; !ok || value != v {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,187 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	orgTypes "github.com/aws/aws-sdk-go-v2/service/organizations/types"
+)
+
+type MockOrganizationsClient struct {
+	accounts []orgTypes.Account
+	parents  map[string][]orgTypes.Account
+	tags     map[string]map[string]string
+	err      error
+}
+
+// ListAccounts returns one account per page to exercise pagination
+func (m *MockOrganizationsClient) ListAccounts(ctx context.Context, params *organizations.ListAccountsInput, optFns ...func(*organizations.Options)) (*organizations.ListAccountsOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	i := 0
+	if params.NextToken != nil {
+		i, _ = strconv.Atoi(*params.NextToken)
+	}
+	out := &organizations.ListAccountsOutput{}
+	if i < len(m.accounts) {
+		out.Accounts = m.accounts[i : i+1]
+	}
+	if i+1 < len(m.accounts) {
+		out.NextToken = aws.String(strconv.Itoa(i + 1))
+	}
+	return out, nil
+}
+
+func (m *MockOrganizationsClient) ListAccountsForParent(ctx context.Context, params *organizations.ListAccountsForParentInput, optFns ...func(*organizations.Options)) (*organizations.ListAccountsForParentOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &organizations.ListAccountsForParentOutput{Accounts: m.parents[*params.ParentId]}, nil
+}
+
+func (m *MockOrganizationsClient) ListTagsForResource(ctx context.Context, params *organizations.ListTagsForResourceInput, optFns ...func(*organizations.Options)) (*organizations.ListTagsForResourceOutput, error) {
+	out := &organizations.ListTagsForResourceOutput{}
+	for k, v := range m.tags[*params.ResourceId] {
+		out.Tags = append(out.Tags, orgTypes.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+	return out, nil
+}
+
+func orgAccount(id, name string, status orgTypes.AccountStatus) orgTypes.Account {
+	return orgTypes.Account{
+		Id:     aws.String(id),
+		Name:   aws.String(name),
+		Arn:    aws.String("arn:aws-us-gov:organizations::999999999999:account/o-example/" + id),
+		Status: status,
+	}
+}
+
+func Test_listOrganizationAccounts(t *testing.T) {
+	client := &MockOrganizationsClient{
+		accounts: []orgTypes.Account{
+			orgAccount("333333333333", "prod", orgTypes.AccountStatusActive),
+			orgAccount("111111111111", "dev", orgTypes.AccountStatusActive),
+			orgAccount("222222222222", "old", orgTypes.AccountStatusSuspended),
+			orgAccount("444444444444", "sandbox", orgTypes.AccountStatusActive),
+		},
+		parents: map[string][]orgTypes.Account{
+			"ou-a": {orgAccount("111111111111", "dev", orgTypes.AccountStatusActive)},
+			"ou-b": {orgAccount("111111111111", "dev", orgTypes.AccountStatusActive), orgAccount("333333333333", "prod", orgTypes.AccountStatusActive)},
+		},
+		tags: map[string]map[string]string{
+			"333333333333": {"env": "prod", "team": "core"},
+			"444444444444": {"env": "sandbox"},
+		},
+	}
+	tests := []struct {
+		name         string
+		org          OrganizationConfig
+		roleTemplate string
+		want         []organizationAccount
+	}{
+		{
+			name: "active accounts with role name",
+			org:  OrganizationConfig{RoleName: "quota-reader"},
+			want: []organizationAccount{
+				{AccountConfig{ID: "111111111111", Name: "dev"}, "arn:aws-us-gov:iam::111111111111:role/quota-reader"},
+				{AccountConfig{ID: "333333333333", Name: "prod"}, "arn:aws-us-gov:iam::333333333333:role/quota-reader"},
+				{AccountConfig{ID: "444444444444", Name: "sandbox"}, "arn:aws-us-gov:iam::444444444444:role/quota-reader"},
+			},
+		},
+		{
+			name:         "status, exclude and role template",
+			org:          OrganizationConfig{Status: []string{"ACTIVE", "SUSPENDED"}, ExcludeAccounts: []string{"444444444444"}},
+			roleTemplate: "arn:aws:iam::{{.AccountID}}:role/{{.AccountName}}-reader",
+			want: []organizationAccount{
+				{AccountConfig{ID: "111111111111", Name: "dev"}, "arn:aws:iam::111111111111:role/dev-reader"},
+				{AccountConfig{ID: "222222222222", Name: "old"}, "arn:aws:iam::222222222222:role/old-reader"},
+				{AccountConfig{ID: "333333333333", Name: "prod"}, "arn:aws:iam::333333333333:role/prod-reader"},
+			},
+		},
+		{
+			name: "organizational units without duplicates",
+			org:  OrganizationConfig{RoleName: "quota-reader", OUs: []string{"ou-a", "ou-b"}},
+			want: []organizationAccount{
+				{AccountConfig{ID: "111111111111", Name: "dev"}, "arn:aws-us-gov:iam::111111111111:role/quota-reader"},
+				{AccountConfig{ID: "333333333333", Name: "prod"}, "arn:aws-us-gov:iam::333333333333:role/quota-reader"},
+			},
+		},
+		{
+			name: "tags",
+			org:  OrganizationConfig{RoleName: "quota-reader", Tags: map[string]string{"env": "prod"}},
+			want: []organizationAccount{
+				{AccountConfig{ID: "333333333333", Name: "prod"}, "arn:aws-us-gov:iam::333333333333:role/quota-reader"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := listOrganizationAccounts(context.Background(), client, "", tt.org, tt.roleTemplate)
+			if err != nil {
+				t.Fatalf("listOrganizationAccounts() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("listOrganizationAccounts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccountResolver_Accounts(t *testing.T) {
+	cfg, _ := config.LoadDefaultConfig(context.TODO())
+	s := &Scraper{cfg: cfg}
+	client := &MockOrganizationsClient{
+		accounts: []orgTypes.Account{
+			orgAccount("111111111111", "dev", orgTypes.AccountStatusActive),
+			orgAccount("222222222222", "", orgTypes.AccountStatusActive),
+		},
+	}
+	job := JobConfig{
+		ServiceCode:  "lambda",
+		Regions:      []string{"us-west-2"},
+		AccountName:  "unnamed",
+		Organization: &OrganizationConfig{RoleName: "quota-reader"},
+	}
+	r := &accountResolver{
+		discoveryCache: newDiscoveryCache[organizationAccount](0), // refreshed on every call
+		scraper:        s,
+		job:            job,
+		orgCfg:         cfg,
+		newClient:      func(cfg aws.Config) OrganizationsClient { return client },
+		mutex:          new(sync.Mutex),
+		discovered:     map[string]*accountScraper{},
+	}
+
+	first, err := r.Accounts(context.Background())
+	if err != nil {
+		t.Fatalf("Accounts() error = %v", err)
+	}
+	if len(first) != 2 || first[0].accountName != "dev" || first[1].accountName != "unnamed" {
+		t.Fatalf("Accounts() = %v, want accounts dev and unnamed", first)
+	}
+
+	// known accounts keep their scraper, removed accounts are dropped
+	client.accounts = client.accounts[1:]
+	second, err := r.Accounts(context.Background())
+	if err != nil {
+		t.Fatalf("Accounts() error = %v", err)
+	}
+	if len(second) != 1 || second[0] != first[1] {
+		t.Errorf("Accounts() = %v, want the scraper of 222222222222", second)
+	}
+
+	// the last known accounts are kept when the organization can't be listed
+	client.err = errors.New("AccessDenied")
+	third, err := r.Accounts(context.Background())
+	if err != nil || len(third) != 1 || third[0] != first[1] {
+		t.Errorf("Accounts() = %v, %v, want the last known accounts", third, err)
+	}
+}
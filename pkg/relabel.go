@@ -0,0 +1,191 @@
+package pkg
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// relabel actions, with the semantics of the Prometheus relabel_configs
+const (
+	RelabelReplace   = "replace"
+	RelabelKeep      = "keep"
+	RelabelDrop      = "drop"
+	RelabelLabelDrop = "labeldrop"
+	RelabelLabelKeep = "labelkeep"
+	RelabelLabelMap  = "labelmap"
+	RelabelHashMod   = "hashmod"
+)
+
+const (
+	defaultRelabelSeparator   = ";"
+	defaultRelabelRegex       = "(.*)"
+	defaultRelabelReplacement = "$1"
+)
+
+var errUnknownRelabelAction = errors.New("unknown action")
+
+// RelabelConfig rewrites the labels of the metrics, or drops metrics, before they are exposed.
+// The metric name is available as the __name__ label, labels starting with __ are removed after relabeling.
+type RelabelConfig struct {
+	SourceLabels []string `yaml:"sourceLabels,omitempty" description:"Labels whose values are concatenated with separator and matched against regex."`
+	Separator    *string  `yaml:"separator,omitempty" description:"Separator of the source label values (default ;)."`
+	Regex        string   `yaml:"regex,omitempty" description:"Regular expression matched against the source value, or the label names for labeldrop, labelkeep and labelmap (default (.*))."`
+	Modulus      uint64   `yaml:"modulus,omitempty" description:"Modulus of the hash of the source value for hashmod."`
+	TargetLabel  string   `yaml:"targetLabel,omitempty" description:"Label set by replace and hashmod, can reference the regex groups."`
+	Replacement  *string  `yaml:"replacement,omitempty" description:"Value set by replace, or label name set by labelmap, can reference the regex groups (default $1)."`
+	Action       string   `yaml:"action,omitempty" description:"Action of the rule (default replace)." enum:"replace,keep,drop,labeldrop,labelkeep,labelmap,hashmod"`
+}
+
+// compiledRelabelConfig is a RelabelConfig with its defaults applied and its regex compiled
+type compiledRelabelConfig struct {
+	RelabelConfig
+	separator   string
+	replacement string
+	regex       *regexp.Regexp
+}
+
+// compileRelabelConfigs checks the rules and applies their defaults
+func compileRelabelConfigs(configs []RelabelConfig) ([]compiledRelabelConfig, error) {
+	compiled := make([]compiledRelabelConfig, 0, len(configs))
+	for i, config := range configs {
+		c, err := compileRelabelConfig(config)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+func compileRelabelConfig(config RelabelConfig) (compiledRelabelConfig, error) {
+	c := compiledRelabelConfig{RelabelConfig: config, separator: defaultRelabelSeparator, replacement: defaultRelabelReplacement}
+	if c.Action == "" {
+		c.Action = RelabelReplace
+	}
+	if config.Separator != nil {
+		c.separator = *config.Separator
+	}
+	if config.Replacement != nil {
+		c.replacement = *config.Replacement
+	}
+	regex := config.Regex
+	if regex == "" {
+		regex = defaultRelabelRegex
+	}
+	var err error
+	if c.regex, err = regexp.Compile("^(?:" + regex + ")$"); err != nil {
+		return c, err
+	}
+	switch c.Action {
+	case RelabelReplace, RelabelHashMod:
+		if c.TargetLabel == "" {
+			return c, fmt.Errorf("%s requires targetLabel", c.Action)
+		}
+		if c.Action == RelabelHashMod && c.Modulus == 0 {
+			return c, fmt.Errorf("hashmod requires a modulus")
+		}
+	case RelabelKeep, RelabelDrop:
+		if len(c.SourceLabels) == 0 {
+			return c, fmt.Errorf("%s requires sourceLabels", c.Action)
+		}
+	case RelabelLabelDrop, RelabelLabelKeep, RelabelLabelMap:
+	default:
+		return c, fmt.Errorf("%w %q", errUnknownRelabelAction, c.Action)
+	}
+	return c, nil
+}
+
+// relabel returns the metrics rewritten by the rules, without the dropped metrics.
+// The metrics are copied, they may be shared with a cache.
+func relabel(metrics []*PrometheusMetric, configs []compiledRelabelConfig) []*PrometheusMetric {
+	if len(configs) == 0 {
+		return metrics
+	}
+	relabeled := make([]*PrometheusMetric, 0, len(metrics))
+	for _, metric := range metrics {
+		if metric == nil {
+			continue
+		}
+		labels := make(map[string]string, len(metric.Labels)+1)
+		for k, v := range metric.Labels {
+			labels[k] = v
+		}
+		labels[model.MetricNameLabel] = metric.Name
+		if !relabelLabels(labels, configs) || labels[model.MetricNameLabel] == "" {
+			continue
+		}
+		m := &PrometheusMetric{Name: labels[model.MetricNameLabel], Value: metric.Value, Desc: metric.Desc, Labels: labels}
+		for k := range labels {
+			if strings.HasPrefix(k, model.ReservedLabelPrefix) {
+				delete(labels, k)
+			}
+		}
+		relabeled = append(relabeled, m)
+	}
+	return relabeled
+}
+
+// relabelLabels applies the rules to labels in place and returns false if the metric is dropped
+func relabelLabels(labels map[string]string, configs []compiledRelabelConfig) bool {
+	for _, c := range configs {
+		values := make([]string, 0, len(c.SourceLabels))
+		for _, name := range c.SourceLabels {
+			values = append(values, labels[name])
+		}
+		value := strings.Join(values, c.separator)
+		switch c.Action {
+		case RelabelKeep:
+			if !c.regex.MatchString(value) {
+				return false
+			}
+		case RelabelDrop:
+			if c.regex.MatchString(value) {
+				return false
+			}
+		case RelabelReplace:
+			indexes := c.regex.FindStringSubmatchIndex(value)
+			if indexes == nil {
+				continue
+			}
+			target := string(c.regex.ExpandString(nil, c.TargetLabel, value, indexes))
+			if !model.LabelName(target).IsValid() {
+				continue
+			}
+			if result := c.regex.ExpandString(nil, c.replacement, value, indexes); len(result) > 0 {
+				labels[target] = string(result)
+			} else {
+				delete(labels, target)
+			}
+		case RelabelHashMod:
+			sum := md5.Sum([]byte(value))
+			labels[c.TargetLabel] = fmt.Sprint(binary.BigEndian.Uint64(sum[8:]) % c.Modulus)
+		case RelabelLabelMap:
+			mapped := map[string]string{}
+			for name, v := range labels {
+				if c.regex.MatchString(name) {
+					mapped[c.regex.ReplaceAllString(name, c.replacement)] = v
+				}
+			}
+			for name, v := range mapped {
+				labels[name] = v
+			}
+		case RelabelLabelDrop, RelabelLabelKeep:
+			for name := range labels {
+				// the metric name is kept
+				if name == model.MetricNameLabel {
+					continue
+				}
+				if c.regex.MatchString(name) == (c.Action == RelabelLabelDrop) {
+					delete(labels, name)
+				}
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,187 @@
+package pkg
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_relabel(t *testing.T) {
+	str := func(s string) *string { return &s }
+	metric := func() *PrometheusMetric {
+		return &PrometheusMetric{
+			Name:  "aws_quota_ec2_running_dedicated_hosts",
+			Value: 10,
+			Desc:  "Amazon EC2: Running Dedicated Hosts",
+			Labels: map[string]string{
+				"type":         "quota",
+				"global_quota": "false",
+				"unit":         "None",
+				"account":      "123456789012",
+				"account_name": "prod",
+				"quota_code":   "L-1",
+			},
+		}
+	}
+	tests := []struct {
+		name    string
+		configs []RelabelConfig
+		want    map[string]string // labels of the metric with __name__, nil when the metric is dropped
+	}{
+		{
+			name:    "labeldrop",
+			configs: []RelabelConfig{{Action: RelabelLabelDrop, Regex: "global_quota|unit"}},
+			want:    map[string]string{"__name__": "aws_quota_ec2_running_dedicated_hosts", "type": "quota", "account": "123456789012", "account_name": "prod", "quota_code": "L-1"},
+		},
+		{
+			name:    "labelkeep",
+			configs: []RelabelConfig{{Action: RelabelLabelKeep, Regex: "type|account"}},
+			want:    map[string]string{"__name__": "aws_quota_ec2_running_dedicated_hosts", "type": "quota", "account": "123456789012"},
+		},
+		{
+			name: "rename with replace",
+			configs: []RelabelConfig{
+				{SourceLabels: []string{"account_name"}, TargetLabel: "aws_account"},
+				{Action: RelabelLabelDrop, Regex: "account_name|global_quota|unit|quota_code"},
+			},
+			want: map[string]string{"__name__": "aws_quota_ec2_running_dedicated_hosts", "type": "quota", "account": "123456789012", "aws_account": "prod"},
+		},
+		{
+			name: "replace with groups, separator and an empty value",
+			configs: []RelabelConfig{
+				{SourceLabels: []string{"account", "account_name"}, Separator: str("/"), Regex: "([0-9]{4}).*/(.*)", TargetLabel: "short", Replacement: str("$2-$1")},
+				{SourceLabels: []string{"__name__"}, Regex: "aws_quota_(.*)", TargetLabel: "__name__", Replacement: str("quota_$1")},
+				{TargetLabel: "unit", Replacement: str("")},
+				{Action: RelabelLabelKeep, Regex: "short|unit"},
+			},
+			want: map[string]string{"__name__": "quota_ec2_running_dedicated_hosts", "short": "prod-1234"},
+		},
+		{
+			name:    "drop",
+			configs: []RelabelConfig{{Action: RelabelDrop, SourceLabels: []string{"unit"}, Regex: "None"}},
+			want:    nil,
+		},
+		{
+			name:    "keep",
+			configs: []RelabelConfig{{Action: RelabelKeep, SourceLabels: []string{"type"}, Regex: "usage"}},
+			want:    nil,
+		},
+		{
+			name: "labelmap and temporary labels",
+			configs: []RelabelConfig{
+				{Action: RelabelLabelMap, Regex: "account(.*)", Replacement: str("__tmp_aws$1")},
+				{Action: RelabelLabelKeep, Regex: "__tmp_.*"},
+				{SourceLabels: []string{"__tmp_aws_name"}, TargetLabel: "owner"},
+			},
+			want: map[string]string{"__name__": "aws_quota_ec2_running_dedicated_hosts", "owner": "prod"},
+		},
+		{
+			name: "hashmod",
+			configs: []RelabelConfig{
+				{Action: RelabelHashMod, SourceLabels: []string{"quota_code"}, Modulus: 1, TargetLabel: "shard"},
+				{Action: RelabelLabelKeep, Regex: "shard"},
+			},
+			want: map[string]string{"__name__": "aws_quota_ec2_running_dedicated_hosts", "shard": "0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compiled, err := compileRelabelConfigs(tt.configs)
+			if err != nil {
+				t.Fatalf("compileRelabelConfigs() error = %v", err)
+			}
+			original := metric()
+			got := relabel([]*PrometheusMetric{original}, compiled)
+			if !reflect.DeepEqual(original, metric()) {
+				t.Errorf("relabel() modified the original metric: %v", original)
+			}
+			if tt.want == nil {
+				if len(got) != 0 {
+					t.Errorf("relabel() = %v, want the metric dropped", got[0])
+				}
+				return
+			}
+			if len(got) != 1 {
+				t.Fatalf("relabel() = %d metrics, want 1", len(got))
+			}
+			labels := map[string]string{"__name__": got[0].Name}
+			for k, v := range got[0].Labels {
+				labels[k] = v
+			}
+			if !reflect.DeepEqual(labels, tt.want) {
+				t.Errorf("relabel() labels = %v, want %v", labels, tt.want)
+			}
+		})
+	}
+}
+
+func Test_compileRelabelConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config RelabelConfig
+		want   string
+	}{
+		{name: "invalid regex", config: RelabelConfig{Action: RelabelLabelDrop, Regex: "("}, want: "error parsing regexp: missing closing ): `^(?:()$`"},
+		{name: "replace without target", config: RelabelConfig{SourceLabels: []string{"unit"}}, want: "replace requires targetLabel"},
+		{name: "hashmod without modulus", config: RelabelConfig{Action: RelabelHashMod, TargetLabel: "shard"}, want: "hashmod requires a modulus"},
+		{name: "drop without source", config: RelabelConfig{Action: RelabelDrop}, want: "drop requires sourceLabels"},
+		{name: "unknown action", config: RelabelConfig{Action: "delete"}, want: `unknown action "delete"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := compileRelabelConfig(tt.config); err == nil || err.Error() != tt.want {
+				t.Errorf("compileRelabelConfig() error = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrometheusCollector_Relabel(t *testing.T) {
+	collector := NewPrometheusCollector(func() ([]*PrometheusMetric, error) {
+		return []*PrometheusMetric{
+			{Name: "aws_quota_test", Value: 1, Desc: "test", Labels: map[string]string{"unit": "None", "region": "us-west-2"}},
+			{Name: "aws_quota_test", Value: 2, Desc: "test", Labels: map[string]string{"unit": "Count", "region": "us-west-2"}},
+		}, nil
+	}, WithRelabelConfigs([]RelabelConfig{
+		{Action: RelabelDrop, SourceLabels: []string{"unit"}, Regex: "None"},
+		{SourceLabels: []string{"region"}, TargetLabel: "aws_region"},
+	}))
+	if got := testutil.CollectAndCount(collector); got != 1 {
+		t.Errorf("collected %d metrics, want 1", got)
+	}
+
+	invalid := NewPrometheusCollector(func() ([]*PrometheusMetric, error) { return nil, nil }, WithRelabelConfigs([]RelabelConfig{{Action: "delete"}}))
+	if err := prometheus.NewPedanticRegistry().Register(invalid); err == nil {
+		t.Error("Register() expected an error for invalid relabelConfigs")
+	}
+}
+
+func Test_parseQuotaConfig_RelabelConfigs(t *testing.T) {
+	qcl, err := parseQuotaConfig([]byte(`relabelConfigs:
+  - action: labeldrop
+    regex: global_quota
+jobs:
+  - serviceCode: ec2
+    regions: [us-west-2]
+    relabelConfigs:
+      - sourceLabels: [account_name]
+        targetLabel: aws_account
+  - serviceCode: lambda
+    regions: [us-west-2]
+`))
+	if err != nil {
+		t.Fatalf("parseQuotaConfig() error = %v", err)
+	}
+	global := RelabelConfig{Action: RelabelLabelDrop, Regex: "global_quota"}
+	want := [][]RelabelConfig{
+		{{SourceLabels: []string{"account_name"}, TargetLabel: "aws_account"}, global},
+		{global},
+	}
+	for i, job := range qcl.Jobs {
+		if !reflect.DeepEqual(job.RelabelConfigs, want[i]) {
+			t.Errorf("job %s relabelConfigs = %v, want %v", job.ServiceCode, job.RelabelConfigs, want[i])
+		}
+	}
+}
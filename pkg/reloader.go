@@ -0,0 +1,339 @@
+package pkg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"golang.org/x/exp/slog"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrNoRegistry is returned when metrics are gathered before the first successful reload
+var ErrNoRegistry = errors.New("No configuration loaded")
+
+// Reloader loads the configuration file and keeps one collector per job registered.
+// Every reload builds a new registry: collectors of unchanged jobs are reused (keeping their cache),
+// collectors of removed jobs are dropped and collectors of new jobs are created.
+// If the new configuration cannot be loaded the previous one stays active.
+type Reloader struct {
+	configFile   string
+	newCollector func(job JobConfig) prometheus.Collector
+	static       []prometheus.Collector
+
+	remote    *remoteConfig // set when configFile is a URL
+	remoteErr error
+
+	reloadMutex *sync.Mutex // serialises reloads
+	collectors  map[string]prometheus.Collector
+	checksum    string // checksum of the last configuration file read
+
+	mutex          *sync.RWMutex // protects the fields below
+	registry       *prometheus.Registry
+	config         *QuotaConfig
+	configChecksum string // checksum of the active configuration
+	lastSuccessful bool
+	lastSuccess    time.Time
+}
+
+// NewReloader is Reloader constructor. newCollector is called once for every new job and
+// static collectors are registered in every registry regardless of the configuration,
+// together with the reloader status metrics.
+func NewReloader(configFile string, newCollector func(job JobConfig) prometheus.Collector, static ...prometheus.Collector) *Reloader {
+	r := &Reloader{
+		configFile:   configFile,
+		newCollector: newCollector,
+		reloadMutex:  new(sync.Mutex),
+		collectors:   map[string]prometheus.Collector{},
+		mutex:        new(sync.RWMutex),
+	}
+	if IsRemoteConfig(configFile) {
+		r.remote, r.remoteErr = newRemoteConfig(configFile)
+	}
+	r.static = append(static, NewPrometheusCollector(r.Metrics))
+	return r
+}
+
+// Reload reads the configuration file and swaps the registered job collectors
+func (r *Reloader) Reload() error {
+	r.reloadMutex.Lock()
+	defer r.reloadMutex.Unlock()
+
+	checksum, data, err := r.read()
+	if err == nil {
+		r.checksum = checksum
+	} else if r.remote != nil || r.remoteErr != nil {
+		r.setStatus(nil, nil, "", false)
+		return err
+	}
+	return r.reload(checksum, data)
+}
+
+// reload loads the configuration read with checksum and data and swaps the registered job collectors,
+// the caller holds reloadMutex
+func (r *Reloader) reload(checksum string, data []byte) error {
+	qcl, err := r.load(data)
+	if err != nil {
+		r.setStatus(nil, nil, "", false)
+		return err
+	}
+
+	reg := prometheus.NewRegistry()
+	for _, c := range r.static {
+		if err := reg.Register(c); err != nil {
+			r.setStatus(nil, nil, "", false)
+			return err
+		}
+	}
+
+	collectors := map[string]prometheus.Collector{}
+	added := 0
+	for _, job := range qcl.Jobs {
+		key, err := jobKey(job)
+		if err != nil {
+			r.setStatus(nil, nil, "", false)
+			return err
+		}
+		if _, ok := collectors[key]; ok {
+			slog.Warn("Duplicate job ignored", "serviceCode", job.ServiceCode, "regions", job.Regions, "role", job.Role, "file", r.jobFile(job))
+			continue
+		}
+		c, ok := r.collectors[key]
+		if !ok {
+			c = r.newCollector(job)
+			added++
+			slog.Debug("Job added", "serviceCode", job.ServiceCode, "regions", job.Regions, "role", job.Role, "file", r.jobFile(job))
+		}
+		collectors[key] = c
+		// registered unchecked: Describe of a job scrapes AWS and would fail the registration of a failing job
+		if err := reg.Register(uncheckedCollector{c}); err != nil {
+			slog.Error("Failed to register metrics: "+err.Error(), "serviceCode", job.ServiceCode, "regions", job.Regions, "role", job.Role, "file", r.jobFile(job))
+		}
+	}
+	removed := 0
+	for key, c := range r.collectors {
+		if _, ok := collectors[key]; !ok {
+			removed++
+			// deletes the cache files of the job once its running scrape is done, without blocking the reload
+			if closer, ok := c.(io.Closer); ok {
+				go closer.Close()
+			}
+		}
+	}
+
+	r.collectors = collectors
+	r.setStatus(reg, qcl, checksum, true)
+	slog.Info("Configuration loaded", "file", r.configFile, "jobs", len(collectors), "added", added, "removed", removed, "unchanged", len(collectors)-added)
+	return nil
+}
+
+// uncheckedCollector registers a job collector without describing (and scraping) it,
+// its metrics are checked when they are gathered
+type uncheckedCollector struct {
+	prometheus.Collector
+}
+
+// Describe sends no descriptor, making the collector unchecked
+func (uncheckedCollector) Describe(chan<- *prometheus.Desc) {}
+
+// Watch polls the configuration file every interval and reloads it when its content changes
+func (r *Reloader) Watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		r.poll()
+	}
+}
+
+// poll reads the configuration once and reloads it when its checksum changed,
+// remote configurations are parsed from the copy fetched to compute the checksum
+func (r *Reloader) poll() {
+	checksum, data, err := r.read()
+	if err != nil {
+		slog.Warn("Unable to read configuration file", "file", r.configFile, "error", err)
+		return
+	}
+	r.reloadMutex.Lock()
+	defer r.reloadMutex.Unlock()
+	if checksum == r.checksum {
+		return
+	}
+	slog.Info("Configuration file changed, reloading", "file", r.configFile)
+	r.checksum = checksum
+	if err := r.reload(checksum, data); err != nil {
+		slog.Error("Error reloading configuration, keeping previous configuration", "file", r.configFile, "error", err)
+	}
+}
+
+// Gather implements prometheus.Gatherer using the registry of the active configuration
+func (r *Reloader) Gather() ([]*dto.MetricFamily, error) {
+	r.mutex.RLock()
+	reg := r.registry
+	r.mutex.RUnlock()
+	if reg == nil {
+		return nil, ErrNoRegistry
+	}
+	return reg.Gather()
+}
+
+// Config returns the active configuration
+func (r *Reloader) Config() *QuotaConfig {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.config
+}
+
+// Metrics returns the reloader status metrics
+func (r *Reloader) Metrics() ([]*PrometheusMetric, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	successful := 0.0
+	if r.lastSuccessful {
+		successful = 1
+	}
+	lastSuccess := 0.0
+	if !r.lastSuccess.IsZero() {
+		lastSuccess = float64(r.lastSuccess.Unix())
+	}
+	metrics := []*PrometheusMetric{
+		{
+			Name:   "aqe_config_last_reload_successful",
+			Labels: map[string]string{},
+			Value:  successful,
+			Desc:   "Whether the last configuration reload attempt was successful",
+		},
+		{
+			Name:   "aqe_config_last_reload_success_timestamp_seconds",
+			Labels: map[string]string{},
+			Value:  lastSuccess,
+			Desc:   "Timestamp of the last successful configuration reload",
+		},
+	}
+	if hash, err := strconv.ParseUint(r.configChecksum[:min(len(r.configChecksum), 12)], 16, 64); err == nil {
+		metrics = append(metrics, &PrometheusMetric{
+			Name:   "aqe_config_hash",
+			Labels: map[string]string{},
+			Value:  float64(hash),
+			Desc:   "Hash of the active configuration (first 48 bits of its SHA-256)",
+		})
+	}
+	if r.remote != nil {
+		fetchSuccessful, lastFetch := r.remote.Status()
+		successful := 0.0
+		if fetchSuccessful {
+			successful = 1
+		}
+		lastFetchSuccess := 0.0
+		if !lastFetch.IsZero() {
+			lastFetchSuccess = float64(lastFetch.Unix())
+		}
+		metrics = append(metrics, &PrometheusMetric{
+			Name:   "aqe_config_last_fetch_successful",
+			Labels: map[string]string{},
+			Value:  successful,
+			Desc:   "Whether the last fetch of the remote configuration was successful",
+		}, &PrometheusMetric{
+			Name:   "aqe_config_last_fetch_success_timestamp_seconds",
+			Labels: map[string]string{},
+			Value:  lastFetchSuccess,
+			Desc:   "Timestamp of the last successful fetch of the remote configuration",
+		})
+	}
+	if r.config != nil {
+		for i, job := range r.config.Jobs {
+			metrics = append(metrics, &PrometheusMetric{
+				Name:   "aqe_config_job_info",
+				Labels: map[string]string{"job": strconv.Itoa(i), "service_code": job.ServiceCode, "file": r.jobFile(job)},
+				Value:  1,
+				Desc:   "Jobs of the active configuration and the file they are defined in",
+			})
+		}
+	}
+	return metrics, nil
+}
+
+// jobFile returns the configuration file of job
+func (r *Reloader) jobFile(job JobConfig) string {
+	if job.Source != "" {
+		return job.Source
+	}
+	return r.configFile
+}
+
+func (r *Reloader) setStatus(reg *prometheus.Registry, qcl *QuotaConfig, checksum string, successful bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.lastSuccessful = successful
+	if successful {
+		r.registry = reg
+		r.config = qcl
+		r.configChecksum = checksum
+		r.lastSuccess = time.Now()
+	}
+}
+
+// read returns the checksum of the configuration, remote configurations are fetched and returned with their checksum
+func (r *Reloader) read() (string, []byte, error) {
+	if r.remoteErr != nil {
+		return "", nil, r.remoteErr
+	}
+	if r.remote == nil {
+		checksum, err := configChecksum(r.configFile)
+		return checksum, nil, err
+	}
+	data, err := r.remote.Fetch(context.Background())
+	if err != nil {
+		return "", nil, err
+	}
+	return dataChecksum(data), data, nil
+}
+
+// load parses the configuration, remote configurations are parsed from data returned by read
+func (r *Reloader) load(data []byte) (*QuotaConfig, error) {
+	if r.remote == nil {
+		return NewQuotaConfig(r.configFile)
+	}
+	return parseRemoteConfig(data)
+}
+
+// jobKey identifies a job by its whole configuration and file, any change creates a new collector
+func jobKey(job JobConfig) (string, error) {
+	b, err := yaml.Marshal(job)
+	if err != nil {
+		return "", err
+	}
+	return job.Source + "\n" + string(b), nil
+}
+
+// configChecksum returns the checksum of the names and contents of the configuration files
+func configChecksum(configFile string) (string, error) {
+	files, err := configFiles(configFile)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(hash, "%s\x00%d\x00", file, len(b))
+		hash.Write(b)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func dataChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
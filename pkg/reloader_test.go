@@ -0,0 +1,172 @@
+package pkg
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func writeConfig(t *testing.T, file, content string) {
+	t.Helper()
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("could not write config: %v", err)
+	}
+}
+
+func TestReloader_Reload(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yml")
+	created := map[string]int{}
+	newCollector := func(job JobConfig) prometheus.Collector {
+		created[job.ServiceCode]++
+		return NewPrometheusCollector(func() ([]*PrometheusMetric, error) {
+			return []*PrometheusMetric{{
+				Name:   createMetricName(job.ServiceCode, "test quota"),
+				Labels: map[string]string{"service_code": job.ServiceCode},
+				Value:  1,
+				Desc:   "test",
+			}}, nil
+		})
+	}
+	r := NewReloader(configFile, newCollector)
+
+	gatheredNames := func() map[string]bool {
+		mfs, err := r.Gather()
+		if err != nil {
+			t.Fatalf("Gather() error = %v", err)
+		}
+		names := map[string]bool{}
+		for _, mf := range mfs {
+			names[mf.GetName()] = true
+		}
+		return names
+	}
+
+	tests := []struct {
+		name        string
+		config      string
+		wantErr     bool
+		wantCreated map[string]int
+		wantMetrics []string
+		notMetrics  []string
+	}{
+		{
+			name:        "initial load",
+			config:      "jobs:\n  - serviceCode: lambda\n    regions: [us-west-2]\n  - serviceCode: ec2\n    regions: [us-west-2]\n",
+			wantCreated: map[string]int{"lambda": 1, "ec2": 1},
+			wantMetrics: []string{"aws_quota_lambda_test_quota", "aws_quota_ec2_test_quota", "aqe_config_last_reload_successful"},
+		},
+		{
+			name:        "remove and add jobs keeps unchanged collectors",
+			config:      "jobs:\n  - serviceCode: lambda\n    regions: [us-west-2]\n  - serviceCode: rds\n    regions: [us-west-2]\n",
+			wantCreated: map[string]int{"lambda": 1, "ec2": 1, "rds": 1},
+			wantMetrics: []string{"aws_quota_lambda_test_quota", "aws_quota_rds_test_quota"},
+			notMetrics:  []string{"aws_quota_ec2_test_quota"},
+		},
+		{
+			name:        "changed job is recreated",
+			config:      "jobs:\n  - serviceCode: lambda\n    regions: [us-east-1]\n  - serviceCode: rds\n    regions: [us-west-2]\n",
+			wantCreated: map[string]int{"lambda": 2, "ec2": 1, "rds": 1},
+			wantMetrics: []string{"aws_quota_lambda_test_quota", "aws_quota_rds_test_quota"},
+		},
+		{
+			name:        "invalid config rolls back",
+			config:      "jobs: [",
+			wantErr:     true,
+			wantCreated: map[string]int{"lambda": 2, "ec2": 1, "rds": 1},
+			wantMetrics: []string{"aws_quota_lambda_test_quota", "aws_quota_rds_test_quota"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeConfig(t, configFile, tt.config)
+			err := r.Reload()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Reload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for code, want := range tt.wantCreated {
+				if created[code] != want {
+					t.Errorf("collectors created for %s = %d, want %d", code, created[code], want)
+				}
+			}
+			names := gatheredNames()
+			for _, name := range tt.wantMetrics {
+				if !names[name] {
+					t.Errorf("expected metric %s to be gathered", name)
+				}
+			}
+			for _, name := range tt.notMetrics {
+				if names[name] {
+					t.Errorf("expected metric %s not to be gathered", name)
+				}
+			}
+			status, _ := r.Metrics()
+			if (status[0].Value == 1) == tt.wantErr {
+				t.Errorf("aqe_config_last_reload_successful = %v, wantErr %v", status[0].Value, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReloader_Collectors(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yml")
+	scrapes := map[string]int{}
+	closed := make(chan string, 2)
+	newCollector := func(job JobConfig) prometheus.Collector {
+		return NewPrometheusCollector(func() ([]*PrometheusMetric, error) {
+			scrapes[job.ServiceCode]++
+			if job.ServiceCode == "ec2" {
+				return nil, errors.New("AccessDenied")
+			}
+			return []*PrometheusMetric{{Name: createMetricName(job.ServiceCode, "test quota"), Labels: map[string]string{}, Value: 1, Desc: "test"}}, nil
+		}, WithClose(func() { closed <- job.ServiceCode }))
+	}
+	r := NewReloader(configFile, newCollector)
+
+	writeConfig(t, configFile, "jobs:\n  - serviceCode: lambda\n    regions: [us-west-2]\n  - serviceCode: ec2\n    regions: [us-west-2]\n")
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if len(scrapes) != 0 {
+		t.Errorf("Reload() scrapes = %v, want no scrape", scrapes)
+	}
+	// the failing job stays registered and is scraped again by the next gather
+	for i := 0; i < 2; i++ {
+		if _, err := r.Gather(); err == nil || !strings.Contains(err.Error(), "AccessDenied") {
+			t.Errorf("Gather() error = %v, want the error of the ec2 job", err)
+		}
+	}
+	if scrapes["ec2"] != 2 || scrapes["lambda"] != 2 {
+		t.Errorf("scrapes = %v, want 2 scrapes of every job", scrapes)
+	}
+
+	writeConfig(t, configFile, "jobs:\n  - serviceCode: lambda\n    regions: [us-west-2]\n")
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	select {
+	case code := <-closed:
+		if code != "ec2" {
+			t.Errorf("closed collector = %s, want ec2", code)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("collector of the removed job not closed")
+	}
+	if _, err := r.Gather(); err != nil {
+		t.Errorf("Gather() error = %v", err)
+	}
+}
+
+func TestReloader_GatherBeforeLoad(t *testing.T) {
+	r := NewReloader("wrong_path/config.yml", func(job JobConfig) prometheus.Collector { return nil })
+	if err := r.Reload(); err == nil {
+		t.Errorf("Reload() expected error for missing file")
+	}
+	if _, err := r.Gather(); err != ErrNoRegistry {
+		t.Errorf("Gather() error = %v, want %v", err, ErrNoRegistry)
+	}
+}
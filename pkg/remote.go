@@ -0,0 +1,196 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"golang.org/x/exp/slog"
+)
+
+// DefaultRemoteConfigInterval is how often a remote configuration is fetched when no watch interval is set
+const DefaultRemoteConfigInterval = 5 * time.Minute
+
+// maxRemoteConfigSize limits the size of a remote configuration
+const maxRemoteConfigSize = 10 << 20
+
+// S3Client interface for easier testing
+type S3Client interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// IsRemoteConfig returns true if configFile is an http(s):// or s3:// URL
+func IsRemoteConfig(configFile string) bool {
+	for _, scheme := range []string{"https://", "http://", "s3://"} {
+		if strings.HasPrefix(configFile, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteConfig fetches a configuration from an http(s):// URL or an s3://bucket/key object.
+// The ETag of the last copy is sent to only download changes, and the last copy is kept when a fetch fails.
+type remoteConfig struct {
+	url         *url.URL
+	httpClient  *http.Client
+	newS3Client func(ctx context.Context, region string) (S3Client, error)
+
+	mutex       *sync.Mutex
+	etag        string
+	data        []byte
+	successful  bool
+	lastSuccess time.Time
+}
+
+func newRemoteConfig(configURL string) (*remoteConfig, error) {
+	u, err := url.Parse(configURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "s3" && (u.Host == "" || strings.Trim(u.Path, "/") == "") {
+		return nil, fmt.Errorf("invalid S3 URL %q, must be s3://bucket/key", configURL)
+	}
+	return &remoteConfig{
+		url:         u,
+		httpClient:  &http.Client{Timeout: time.Minute},
+		newS3Client: newS3Client,
+		mutex:       new(sync.Mutex),
+	}, nil
+}
+
+// newS3Client creates an S3 client with the default configuration, in region when set
+func newS3Client(ctx context.Context, region string) (S3Client, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if region != "" {
+		cfg.Region = region
+	}
+	return s3.NewFromConfig(cfg), nil
+}
+
+// Fetch returns the configuration, downloading it only if it changed since the last fetch.
+// On error the last copy is kept for the next fetches.
+func (c *remoteConfig) Fetch(ctx context.Context) ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var (
+		data, etag string
+		modified   bool
+		err        error
+	)
+	if c.url.Scheme == "s3" {
+		data, etag, modified, err = c.fetchS3(ctx)
+	} else {
+		data, etag, modified, err = c.fetchHTTP(ctx)
+	}
+	if err != nil {
+		c.successful = false
+		if c.data != nil {
+			slog.Warn("Failed to fetch configuration, keeping the last copy", "url", c.url.Redacted(), "error", err)
+		}
+		return nil, err
+	}
+	c.successful = true
+	c.lastSuccess = time.Now()
+	if modified {
+		c.data, c.etag = []byte(data), etag
+		slog.Debug("Configuration fetched", "url", c.url.Redacted(), "etag", etag)
+	}
+	return c.data, nil
+}
+
+// fetchHTTP downloads the configuration with If-None-Match
+func (c *remoteConfig) fetchHTTP(ctx context.Context) (string, string, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url.String(), nil)
+	if err != nil {
+		return "", "", false, err
+	}
+	if c.etag != "" && c.data != nil {
+		req.Header.Set("If-None-Match", c.etag)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", "", false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return "", "", false, nil
+	case http.StatusOK:
+	default:
+		return "", "", false, fmt.Errorf("unexpected status %s fetching %s", resp.Status, c.url.Redacted())
+	}
+	data, err := readConfigBody(resp.Body)
+	if err != nil {
+		return "", "", false, err
+	}
+	return data, resp.Header.Get("ETag"), true, nil
+}
+
+// fetchS3 downloads the configuration object with IfNoneMatch, the region can be set with ?region=
+func (c *remoteConfig) fetchS3(ctx context.Context) (string, string, bool, error) {
+	client, err := c.newS3Client(ctx, c.url.Query().Get("region"))
+	if err != nil {
+		return "", "", false, err
+	}
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(c.url.Host),
+		Key:    aws.String(strings.TrimPrefix(c.url.Path, "/")),
+	}
+	if c.etag != "" && c.data != nil {
+		input.IfNoneMatch = aws.String(c.etag)
+	}
+	out, err := client.GetObject(ctx, input)
+	if err != nil {
+		var respErr *smithyhttp.ResponseError
+		if errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusNotModified {
+			return "", "", false, nil
+		}
+		return "", "", false, err
+	}
+	defer out.Body.Close()
+	data, err := readConfigBody(out.Body)
+	if err != nil {
+		return "", "", false, err
+	}
+	return data, aws.ToString(out.ETag), true, nil
+}
+
+// Data returns the last fetched copy of the configuration
+func (c *remoteConfig) Data() []byte {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.data
+}
+
+// Status returns whether the last fetch was successful and the time of the last successful fetch
+func (c *remoteConfig) Status() (bool, time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.successful, c.lastSuccess
+}
+
+func readConfigBody(body io.Reader) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(body, maxRemoteConfigSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxRemoteConfigSize {
+		return "", fmt.Errorf("configuration larger than %d bytes", maxRemoteConfigSize)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,200 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// configServer serves a configuration with its ETag, answering 304 to If-None-Match
+type configServer struct {
+	mutex  sync.Mutex
+	path   string
+	config string
+	fail   bool
+	notMod int
+	served int
+}
+
+func (c *configServer) set(config string, fail bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.config, c.fail = config, fail
+}
+
+func (c *configServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.fail || r.URL.Path != c.path {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	etag := fmt.Sprintf(`"%s"`, dataChecksum([]byte(c.config))[:16])
+	if r.Header.Get("If-None-Match") == etag {
+		c.notMod++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	c.served++
+	w.Header().Set("ETag", etag)
+	fmt.Fprint(w, c.config)
+}
+
+func Test_remoteConfig_Fetch(t *testing.T) {
+	httpServer := &configServer{path: "/config.yml"}
+	s3Server := &configServer{path: "/quota-config/aqe/config.yml"}
+	tests := []struct {
+		name   string
+		server *configServer
+		url    func(server *httptest.Server) string
+		setup  func(c *remoteConfig, server *httptest.Server)
+	}{
+		{
+			name:   "http",
+			server: httpServer,
+			url:    func(server *httptest.Server) string { return server.URL + "/config.yml" },
+		},
+		{
+			name:   "s3",
+			server: s3Server,
+			url:    func(server *httptest.Server) string { return "s3://quota-config/aqe/config.yml?region=eu-west-1" },
+			setup: func(c *remoteConfig, server *httptest.Server) {
+				c.newS3Client = func(ctx context.Context, region string) (S3Client, error) {
+					return s3.New(s3.Options{
+						Region:           region,
+						BaseEndpoint:     aws.String(server.URL),
+						UsePathStyle:     true,
+						RetryMaxAttempts: 1,
+						Credentials:      credentials.NewStaticCredentialsProvider("AKID", "secret", ""),
+					}), nil
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.server)
+			defer server.Close()
+			c, err := newRemoteConfig(tt.url(server))
+			if err != nil {
+				t.Fatalf("newRemoteConfig() error = %v", err)
+			}
+			if tt.setup != nil {
+				tt.setup(c, server)
+			}
+
+			tt.server.set("jobs: []\n", false)
+			if data, err := c.Fetch(context.Background()); err != nil || string(data) != "jobs: []\n" {
+				t.Fatalf("Fetch() = %q, %v", data, err)
+			}
+			// unchanged configuration is not downloaded again
+			if data, err := c.Fetch(context.Background()); err != nil || string(data) != "jobs: []\n" || tt.server.notMod != 1 {
+				t.Fatalf("Fetch() = %q, %v with %d not modified responses, want 1", data, err, tt.server.notMod)
+			}
+			// the last copy is kept when the fetch fails
+			tt.server.set("", true)
+			if _, err := c.Fetch(context.Background()); err == nil {
+				t.Fatal("Fetch() expected an error")
+			}
+			if successful, _ := c.Status(); successful || string(c.Data()) != "jobs: []\n" {
+				t.Errorf("Status() = %v and Data() = %q, want the last copy", successful, c.Data())
+			}
+			tt.server.set("jobs:\n  - serviceCode: ec2\n", false)
+			if data, err := c.Fetch(context.Background()); err != nil || string(data) != "jobs:\n  - serviceCode: ec2\n" {
+				t.Fatalf("Fetch() = %q, %v, want the new configuration", data, err)
+			}
+		})
+	}
+}
+
+func TestReloader_RemoteConfig(t *testing.T) {
+	config := &configServer{path: "/config.yml"}
+	server := httptest.NewServer(config)
+	defer server.Close()
+	config.set("jobs:\n  - serviceCode: lambda\n    regions: [us-west-2]\n", false)
+
+	r := NewReloader(server.URL+"/config.yml", func(job JobConfig) prometheus.Collector {
+		return NewPrometheusCollector(func() ([]*PrometheusMetric, error) { return nil, nil })
+	})
+	metricValues := func() map[string]float64 {
+		metrics, _ := r.Metrics()
+		values := map[string]float64{}
+		for _, m := range metrics {
+			values[m.Name] = m.Value
+		}
+		return values
+	}
+
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	first := metricValues()
+	if first["aqe_config_hash"] == 0 || first["aqe_config_last_fetch_successful"] != 1 || first["aqe_config_last_fetch_success_timestamp_seconds"] == 0 {
+		t.Errorf("metrics = %v, want a hash and a successful fetch", first)
+	}
+
+	// an invalid configuration keeps the previous one
+	config.set("jobs:\n  - serviceCode: lambda\n    regions: [useast1]\n", false)
+	if err := r.Reload(); err == nil {
+		t.Error("Reload() expected an error")
+	}
+	if got := r.Config().Jobs[0].Regions[0]; got != "us-west-2" {
+		t.Errorf("active region = %s, want the previous configuration", got)
+	}
+
+	config.set("jobs:\n  - serviceCode: lambda\n    regions: [us-east-1]\n", false)
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if second := metricValues(); second["aqe_config_hash"] == first["aqe_config_hash"] {
+		t.Error("aqe_config_hash unchanged after the configuration changed")
+	}
+
+	// a poll fetches the configuration once, to compute its checksum and to load it
+	config.set("jobs:\n  - serviceCode: lambda\n    regions: [eu-west-1]\n", false)
+	config.served, config.notMod = 0, 0
+	r.poll()
+	if got := r.Config().Jobs[0].Regions[0]; got != "eu-west-1" || config.served != 1 || config.notMod != 0 {
+		t.Errorf("poll() loaded %s with %d fetches and %d not modified, want eu-west-1 with 1 fetch", got, config.served, config.notMod)
+	}
+	r.poll()
+	if config.served != 1 || config.notMod != 1 {
+		t.Errorf("poll() of an unchanged configuration = %d fetches and %d not modified, want 1 and 1", config.served, config.notMod)
+	}
+}
+
+func Test_parseRemoteConfig_NoExpansion(t *testing.T) {
+	t.Setenv("HOME", "/root")
+	qcl, err := parseRemoteConfig([]byte(`jobs:
+  - serviceCode: lambda
+    regions: [us-west-2]
+    labels:
+      home: ${HOME}
+      passwd: file:/etc/passwd
+`))
+	if err != nil {
+		t.Fatalf("parseRemoteConfig() error = %v", err)
+	}
+	if labels := qcl.Jobs[0].Labels; labels["home"] != "${HOME}" || labels["passwd"] != "file:/etc/passwd" {
+		t.Errorf("labels = %v, want the values left as-is", labels)
+	}
+
+	_, err = parseRemoteConfig([]byte(`jobs:
+  - serviceCode: lambda
+    regions: [us-west-2]
+    role: arn:aws:iam::111111111111:role/quota-reader
+    externalId_file: /etc/passwd
+`))
+	if err == nil || !strings.Contains(err.Error(), "externalId_file") {
+		t.Errorf("parseRemoteConfig() error = %v, want externalId_file rejected", err)
+	}
+}
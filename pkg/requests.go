@@ -0,0 +1,72 @@
+package pkg
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sq "github.com/aws/aws-sdk-go-v2/service/servicequotas"
+	sqTypes "github.com/aws/aws-sdk-go-v2/service/servicequotas/types"
+)
+
+// QuotaRequestsClient interface for easier testing
+type QuotaRequestsClient interface {
+	ListRequestedServiceQuotaChangeHistory(ctx context.Context, params *sq.ListRequestedServiceQuotaChangeHistoryInput, optFns ...func(*sq.Options)) (*sq.ListRequestedServiceQuotaChangeHistoryOutput, error)
+}
+
+// getQuotaRequests returns the quota increase requests of serviceCode kept by filter in the region of jobRegionCfg as metrics
+func getQuotaRequests(ctx context.Context, client QuotaRequestsClient, serviceCode string, filter *quotaFilter, jobRegionCfg JobRegion) ([]*PrometheusMetric, error) {
+	opts := func(o *sq.Options) { o.Region = jobRegionCfg.Region }
+	input := &sq.ListRequestedServiceQuotaChangeHistoryInput{ServiceCode: aws.String(serviceCode), MaxResults: &maxResults}
+	requests := []sqTypes.RequestedServiceQuotaChange{}
+	for {
+		r, err := client.ListRequestedServiceQuotaChangeHistory(ctx, input, opts)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, r.RequestedQuotas...)
+		if r.NextToken == nil {
+			break
+		}
+		input.NextToken = r.NextToken
+	}
+	return transformQuotaRequests(filter.FilterRequests(requests), jobRegionCfg), nil
+}
+
+// transformQuotaRequests creates the desired value and creation time metrics of every request
+func transformQuotaRequests(requests []sqTypes.RequestedServiceQuotaChange, jobRegionCfg JobRegion) []*PrometheusMetric {
+	metrics := []*PrometheusMetric{}
+	for _, r := range requests {
+		desiredValue := aws.ToFloat64(r.DesiredValue)
+		labels := func() map[string]string {
+			return withJobLabels(map[string]string{
+				"request_id":    aws.ToString(r.Id),
+				"case_id":       aws.ToString(r.CaseId),
+				"status":        string(r.Status),
+				"desired_value": strconv.FormatFloat(desiredValue, 'f', -1, 64),
+				"region":        jobRegionCfg.Region,
+				"account":       jobRegionCfg.AccountID,
+				"account_name":  jobRegionCfg.AccountName,
+				"name":          aws.ToString(r.QuotaName),
+				"quota_code":    aws.ToString(r.QuotaCode),
+				"service_code":  aws.ToString(r.ServiceCode),
+			}, jobRegionCfg.Labels)
+		}
+		metrics = append(metrics, &PrometheusMetric{
+			Name:   "aws_quota_request_desired_value",
+			Value:  desiredValue,
+			Labels: labels(),
+			Desc:   "Value requested by a quota increase request",
+		})
+		// a timestamp rather than an age, which would go stale in the cache
+		if r.Created != nil {
+			metrics = append(metrics, &PrometheusMetric{
+				Name:   "aws_quota_request_created_timestamp_seconds",
+				Value:  float64(r.Created.UnixNano()) / 1e9,
+				Labels: labels(),
+				Desc:   "Unix time when a quota increase request was created",
+			})
+		}
+	}
+	return metrics
+}
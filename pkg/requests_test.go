@@ -0,0 +1,110 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sq "github.com/aws/aws-sdk-go-v2/service/servicequotas"
+	sqTypes "github.com/aws/aws-sdk-go-v2/service/servicequotas/types"
+)
+
+type MockQuotaRequestsClient struct {
+	pages [][]sqTypes.RequestedServiceQuotaChange
+	err   error
+	calls []*sq.ListRequestedServiceQuotaChangeHistoryInput
+}
+
+func (m *MockQuotaRequestsClient) ListRequestedServiceQuotaChangeHistory(ctx context.Context, params *sq.ListRequestedServiceQuotaChangeHistoryInput, optFns ...func(*sq.Options)) (*sq.ListRequestedServiceQuotaChangeHistoryOutput, error) {
+	input := *params
+	m.calls = append(m.calls, &input)
+	if m.err != nil {
+		return nil, m.err
+	}
+	page := 0
+	if params.NextToken != nil {
+		page = len(*params.NextToken)
+	}
+	out := &sq.ListRequestedServiceQuotaChangeHistoryOutput{RequestedQuotas: m.pages[page]}
+	if page+1 < len(m.pages) {
+		out.NextToken = aws.String(string(make([]byte, page+1)))
+	}
+	return out, nil
+}
+
+func quotaRequest(id string, status sqTypes.RequestStatus, desiredValue float64, created time.Time) sqTypes.RequestedServiceQuotaChange {
+	return sqTypes.RequestedServiceQuotaChange{
+		Id:           aws.String(id),
+		CaseId:       aws.String("case-" + id),
+		Status:       status,
+		DesiredValue: aws.Float64(desiredValue),
+		Created:      aws.Time(created),
+		QuotaCode:    aws.String("L-1216C47A"),
+		QuotaName:    aws.String("Running On-Demand Standard instances"),
+		ServiceCode:  aws.String("ec2"),
+	}
+}
+
+func Test_getQuotaRequests(t *testing.T) {
+	created := time.Now().Add(-time.Hour)
+	client := &MockQuotaRequestsClient{pages: [][]sqTypes.RequestedServiceQuotaChange{
+		{quotaRequest("1", sqTypes.RequestStatusPending, 256, created)},
+		{quotaRequest("2", sqTypes.RequestStatusApproved, 128, created)},
+	}}
+	metrics, err := getQuotaRequests(context.Background(), client, "ec2", nil, JobRegion{Region: "us-east-1", AccountID: "111111111111"})
+	if err != nil {
+		t.Fatalf("getQuotaRequests() error = %v", err)
+	}
+	if len(client.calls) != 2 || aws.ToString(client.calls[0].ServiceCode) != "ec2" {
+		t.Errorf("getQuotaRequests() calls = %d, want 2 pages of ec2", len(client.calls))
+	}
+	if len(metrics) != 4 {
+		t.Fatalf("getQuotaRequests() = %d metrics, want 4", len(metrics))
+	}
+
+	// the requests of the quotas excluded by the job are skipped
+	filter, _ := newQuotaFilter(nil, []QuotaFilter{{QuotaCode: "L-1216*"}})
+	client = &MockQuotaRequestsClient{pages: [][]sqTypes.RequestedServiceQuotaChange{{quotaRequest("1", sqTypes.RequestStatusPending, 256, created)}}}
+	if metrics, err := getQuotaRequests(context.Background(), client, "ec2", filter, JobRegion{Region: "us-east-1"}); err != nil || len(metrics) != 0 {
+		t.Errorf("getQuotaRequests() = %d metrics, %v, want the request excluded", len(metrics), err)
+	}
+
+	client = &MockQuotaRequestsClient{err: errors.New("AccessDeniedException")}
+	if _, err := getQuotaRequests(context.Background(), client, "ec2", nil, JobRegion{Region: "us-east-1"}); err == nil {
+		t.Error("getQuotaRequests() error = nil, want the error of the client")
+	}
+}
+
+func Test_transformQuotaRequests(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	requests := []sqTypes.RequestedServiceQuotaChange{quotaRequest("1", sqTypes.RequestStatusCaseOpened, 256, created)}
+	metrics := transformQuotaRequests(requests, JobRegion{
+		Region:      "us-east-1",
+		AccountID:   "111111111111",
+		AccountName: "prod",
+		Labels:      map[string]string{"team": "platform"},
+	})
+	labels := map[string]string{
+		"request_id":    "1",
+		"case_id":       "case-1",
+		"status":        "CASE_OPENED",
+		"desired_value": "256",
+		"region":        "us-east-1",
+		"account":       "111111111111",
+		"account_name":  "prod",
+		"name":          "Running On-Demand Standard instances",
+		"quota_code":    "L-1216C47A",
+		"service_code":  "ec2",
+		"team":          "platform",
+	}
+	want := []*PrometheusMetric{
+		{Name: "aws_quota_request_desired_value", Value: 256, Labels: labels, Desc: "Value requested by a quota increase request"},
+		{Name: "aws_quota_request_created_timestamp_seconds", Value: 1704067200, Labels: labels, Desc: "Unix time when a quota increase request was created"},
+	}
+	if !reflect.DeepEqual(metrics, want) {
+		t.Errorf("transformQuotaRequests() = %v, want %v", metrics, want)
+	}
+}
@@ -0,0 +1,218 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// jsonSchemaDraft is the JSON Schema version of Schema
+const jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// jsonSchema is the subset of JSON Schema describing the configuration
+type jsonSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	PatternProperties    map[string]*jsonSchema `json:"patternProperties,omitempty"`
+	AdditionalProperties interface{}            `json:"additionalProperties,omitempty"` // false or the schema of the values
+	Items                *jsonSchema            `json:"items,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	MinLength            int                    `json:"minLength,omitempty"`
+	MaxLength            int                    `json:"maxLength,omitempty"`
+
+	pattern  *regexp.Regexp
+	secret   bool // the value is not printed in errors
+	optional bool // the empty value is unset (omitempty)
+}
+
+// configSchema is generated once from the tags of QuotaConfig
+var configSchema = newConfigSchema()
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func newConfigSchema() *jsonSchema {
+	schema := typeSchema(reflect.TypeOf(QuotaConfig{}))
+	schema.Schema = jsonSchemaDraft
+	schema.Title = "AWS Quota Exporter configuration"
+	return schema
+}
+
+// Schema returns the JSON Schema of the configuration file, generated from the tags of QuotaConfig and JobConfig.
+// The values of the configuration are validated against the same schema when it is loaded.
+func Schema() ([]byte, error) {
+	return json.MarshalIndent(configSchema, "", "  ")
+}
+
+// typeSchema returns the schema of the values of type t
+func typeSchema(t reflect.Type) *jsonSchema {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == durationType {
+		return &jsonSchema{Type: "string"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &jsonSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &jsonSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &jsonSchema{Type: "number"}
+	case reflect.Slice:
+		return &jsonSchema{Type: "array", Items: typeSchema(t.Elem())}
+	case reflect.Map:
+		return &jsonSchema{Type: "object", AdditionalProperties: typeSchema(t.Elem())}
+	case reflect.Struct:
+		schema := &jsonSchema{
+			Type:       "object",
+			Properties: map[string]*jsonSchema{},
+			// values read from files, e.g. externalId_file: /run/secrets/external-id
+			PatternProperties: map[string]*jsonSchema{
+				"^.+" + fileKeySuffix + "$": {Type: "string", Description: "File containing the value of the key without the " + fileKeySuffix + " suffix."},
+			},
+			AdditionalProperties: false,
+		}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			if field.Anonymous && strings.Contains(field.Tag.Get("yaml"), ",inline") {
+				// the keys of inlined structs are keys of the struct
+				for key, property := range typeSchema(field.Type).Properties {
+					schema.Properties[key] = property
+				}
+				continue
+			}
+			schema.Properties[name] = fieldSchema(field)
+		}
+		return schema
+	default:
+		return &jsonSchema{Type: "string"}
+	}
+}
+
+// fieldSchema returns the schema of a struct field, the title, enum, pattern and length tags of lists apply to their items
+func fieldSchema(field reflect.StructField) *jsonSchema {
+	schema := typeSchema(field.Type)
+	schema.Description = field.Tag.Get("description")
+	values := schema
+	if schema.Type == "array" {
+		values = schema.Items
+	}
+	values.Title = field.Tag.Get("title")
+	if enum := field.Tag.Get("enum"); enum != "" {
+		values.Enum = strings.Split(enum, ",")
+	}
+	if pattern := field.Tag.Get("pattern"); pattern != "" {
+		values.Pattern = pattern
+		values.pattern = regexp.MustCompile(pattern)
+	}
+	values.MinLength, _ = strconv.Atoi(field.Tag.Get("minLength"))
+	values.MaxLength, _ = strconv.Atoi(field.Tag.Get("maxLength"))
+	values.secret = field.Tag.Get("secret") == "true"
+	schema.optional = strings.Contains(field.Tag.Get("yaml"), ",omitempty")
+	return schema
+}
+
+// validateSchema checks the string values of node against schema, name is the key of node.
+// The types and unknown keys are reported when the configuration is decoded.
+func validateSchema(schema *jsonSchema, node *yaml.Node, name string, errs *ConfigErrors) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			validateSchema(schema, child, name, errs)
+		}
+	case yaml.MappingNode:
+		if schema.Type != "object" {
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if property, ok := schema.Properties[key.Value]; ok {
+				validateSchema(property, value, key.Value, errs)
+			} else if values, ok := schema.AdditionalProperties.(*jsonSchema); ok {
+				validateSchema(values, value, key.Value, errs)
+			}
+		}
+	case yaml.SequenceNode:
+		if schema.Type != "array" {
+			return
+		}
+		for _, item := range node.Content {
+			validateSchema(schema.Items, item, name, errs)
+		}
+	case yaml.ScalarNode:
+		if schema.Type != "string" || node.Tag == "!!null" || (node.Value == "" && schema.optional) {
+			return
+		}
+		if msg := schema.check(node.Value); msg != "" {
+			if schema.Title != "" {
+				name = schema.Title
+			}
+			value := fmt.Sprintf(" %q", node.Value)
+			if schema.secret {
+				value = ""
+			}
+			*errs = append(*errs, ConfigError{Line: node.Line, Msg: fmt.Sprintf("invalid %s%s, %s", name, value, msg)})
+		}
+	}
+}
+
+// redactSecrets replaces the secret values of node with <secret>, like validateSchema hides them in errors
+func redactSecrets(schema *jsonSchema, node *yaml.Node) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			redactSecrets(schema, child)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if property, ok := schema.Properties[key.Value]; ok {
+				redactSecrets(property, value)
+			} else if values, ok := schema.AdditionalProperties.(*jsonSchema); ok {
+				redactSecrets(values, value)
+			}
+		}
+	case yaml.SequenceNode:
+		if schema.Items == nil {
+			return
+		}
+		for _, item := range node.Content {
+			redactSecrets(schema.Items, item)
+		}
+	case yaml.ScalarNode:
+		if schema.secret && node.Value != "" {
+			node.Value, node.Tag, node.Style = "<secret>", "!!str", 0
+		}
+	}
+}
+
+// check returns why value does not match the schema, or an empty string
+func (s *jsonSchema) check(value string) string {
+	length := utf8.RuneCountInString(value)
+	if (s.MinLength > 0 && length < s.MinLength) || (s.MaxLength > 0 && length > s.MaxLength) {
+		return fmt.Sprintf("must be %d to %d characters", s.MinLength, s.MaxLength)
+	}
+	if len(s.Enum) > 0 && !contains(s.Enum, value) {
+		return fmt.Sprintf("must be one of %s", strings.Join(s.Enum, ", "))
+	}
+	if s.pattern != nil && !s.pattern.MatchString(value) {
+		return fmt.Sprintf("must match %s", s.Pattern)
+	}
+	return ""
+}
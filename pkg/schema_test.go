@@ -0,0 +1,99 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	data, err := Schema()
+	if err != nil {
+		t.Fatalf("Schema() error = %v", err)
+	}
+	var schema struct {
+		Schema     string `json:"$schema"`
+		Properties struct {
+			Jobs struct {
+				Type  string
+				Items struct {
+					AdditionalProperties bool
+					Properties           map[string]struct {
+						Type        string
+						Description string
+						Pattern     string
+						Enum        []string
+						Items       struct {
+							Title   string
+							Pattern string
+						}
+					}
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("Schema() is not valid JSON: %v", err)
+	}
+	if schema.Schema != jsonSchemaDraft || schema.Properties.Jobs.Type != "array" || schema.Properties.Jobs.Items.AdditionalProperties {
+		t.Errorf("Schema() = %s", data)
+	}
+	job := schema.Properties.Jobs.Items.Properties
+	if regions := job["regions"]; regions.Type != "array" || regions.Items.Title != "region" || regions.Items.Pattern == "" {
+		t.Errorf("regions = %+v, want an array of regions with a pattern", regions)
+	}
+	if role := job["role"]; !strings.HasPrefix(role.Pattern, "^arn:") {
+		t.Errorf("role pattern = %q, want a role ARN pattern", role.Pattern)
+	}
+	if listMerge := job["listMerge"]; !reflect.DeepEqual(listMerge.Enum, []string{ListMergeReplace, ListMergeMerge}) {
+		t.Errorf("listMerge enum = %v", listMerge.Enum)
+	}
+	if cacheDuration := job["cacheDuration"]; cacheDuration.Type != "string" {
+		t.Errorf("cacheDuration type = %q, want string", cacheDuration.Type)
+	}
+	for name, property := range job {
+		if property.Description == "" {
+			t.Errorf("job property %s has no description", name)
+		}
+	}
+	if _, ok := job["Source"]; ok {
+		t.Error("Source is not a configuration key")
+	}
+}
+
+func Test_validateSchema(t *testing.T) {
+	_, err := parseQuotaConfig([]byte(`defaults:
+  regions: [us-west-2, eu_west_1]
+  role: arn:aws:iam::{{.AccountID}}:role/quota-reader
+jobs:
+  - serviceCode: ec2
+    externalId: x
+    accounts:
+      - id: 111111111111
+        name: ${AQE_UNSET_NAME:-dev}
+      - id: ""
+  - serviceCode: lambda
+    regions: [us-east-1]
+    listMerge: append
+    role: ""
+    organization:
+      roleName: quota-reader
+      tags:
+        team: platform
+`))
+	var got ConfigErrors
+	if !errors.As(err, &got) {
+		t.Fatalf("parseQuotaConfig() error = %v, want ConfigErrors", err)
+	}
+	want := ConfigErrors{
+		{Line: 2, Msg: `invalid region "eu_west_1", must match ^(\*|[a-z]{2}(-[a-z]+)?-[a-z]+-[0-9]+)$`},
+		{Line: 6, Msg: "invalid externalId, must be 2 to 1224 characters"},
+		{Line: 10, Msg: `invalid account id "", must match ^[0-9]{12}$`},
+		{Line: 13, Msg: `invalid listMerge "append", must be one of replace, merge`},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseQuotaConfig() errors = %v, want %v", got, want)
+	}
+}
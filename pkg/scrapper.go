@@ -3,8 +3,8 @@ package pkg
 // Documentation for interacting with aws-sdk-go-v2 https://aws.github.io/aws-sdk-go-v2/docs/getting-started/
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -13,7 +13,6 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/aws/arn"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	cw "github.com/aws/aws-sdk-go-v2/service/cloudwatch"
 	cwTypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
 	sq "github.com/aws/aws-sdk-go-v2/service/servicequotas"
@@ -23,17 +22,47 @@ import (
 )
 
 const (
-	defaultCloudwatchTimePeriod = int32(15) // minutes, there can be up to 15 min delay in CloudWatch
-	maxSimilarity               = 0.53
+	maxSimilarity = 0.53
 )
 
 var (
 	maxResults int32 = 100
+	// maxMetricDataQueries is the maximum number of queries of a GetMetricData request
+	maxMetricDataQueries = 500
+	// maxServiceConcurrency is the number of services of an account scraped at once
+	maxServiceConcurrency = 4
 )
 
 // Scraper struct
 type Scraper struct {
-	cfg aws.Config
+	cfg               aws.Config
+	discoveryInterval time.Duration
+	collectRequests   bool
+	limiter           *apiLimiter
+}
+
+// ScraperOption configures a Scraper
+type ScraperOption func(s *Scraper)
+
+// WithCollectRequests collects the quota increase requests of the jobs that do not set collectRequests
+func WithCollectRequests(collectRequests bool) ScraperOption {
+	return func(s *Scraper) {
+		s.collectRequests = collectRequests
+	}
+}
+
+// WithAPILimits limits the rate and concurrency of the AWS API calls of every account, and sets their retry mode and attempts
+func WithAPILimits(limits APILimits) ScraperOption {
+	return func(s *Scraper) {
+		s.limiter = newAPILimiter(limits)
+	}
+}
+
+// WithDiscoveryInterval sets how often discovered regions are refreshed
+func WithDiscoveryInterval(interval time.Duration) ScraperOption {
+	return func(s *Scraper) {
+		s.discoveryInterval = interval
+	}
 }
 
 type chanData struct {
@@ -43,104 +72,212 @@ type chanData struct {
 
 // QuotaUsage to combine Quota + Usage data
 type QuotaUsage struct {
-	Quota sqTypes.ServiceQuota
-	Usage float64
+	Quota    sqTypes.ServiceQuota
+	Usage    float64
+	HasUsage bool     // a usage datapoint was read from CloudWatch
+	Default  *float64 // AWS default value of the quota, nil when unknown
 }
 
 // JobRegion represents the details of a job's associated AWS region and account.
-// It includes the region name, the account's display name, and the account's unique ID.
+// It includes the region name, the account's display name, the account's unique ID, and the static labels and metric names of the job.
 type JobRegion struct {
 	Region      string
 	AccountName string
 	AccountID   string
+	Labels      map[string]string      // static labels of the job
+	MetricNames map[string]QuotaMetric // fixed metric names of the job by serviceCode/quotaCode
+	Usage       *UsageConfig           // CloudWatch options of the usage
 }
 
 // CloudWatchClient interface for easier testing
 type CloudWatchClient interface {
 	GetMetricStatistics(ctx context.Context, params *cw.GetMetricStatisticsInput, optFns ...func(*cw.Options)) (*cw.GetMetricStatisticsOutput, error)
+	GetMetricData(ctx context.Context, params *cw.GetMetricDataInput, optFns ...func(*cw.Options)) (*cw.GetMetricDataOutput, error)
 }
 
 // NewScraper creates a new Scraper
-func NewScraper() (*Scraper, error) {
+func NewScraper(opts ...ScraperOption) (*Scraper, error) {
 	cfg, err := config.LoadDefaultConfig(context.TODO())
 	if err != nil {
 		return &Scraper{}, err
 	}
 
-	return &Scraper{cfg: cfg}, nil
+	s := &Scraper{cfg: cfg, discoveryInterval: DefaultDiscoveryInterval, limiter: newAPILimiter(APILimits{})}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, s.limiter.limits.validate()
 }
 
-// CreateScraper Scrape Quotas from AWS
+// CreateScraper Scrape Quotas from AWS.
+// cacheDuration, cacheServeStale and collectUsage are used unless the job overrides them.
 func (s *Scraper) CreateScraper(job JobConfig, cacheDuration *time.Duration, cacheServeStale bool, collectUsage bool) func() ([]*PrometheusMetric, error) {
+	scrape, _ := s.createScraper(job, cacheDuration, cacheServeStale, collectUsage)
+	return scrape
+}
+
+// CreateCollector returns the collector of the scraper of job with its relabeling rules,
+// closing the collector deletes the cache files of the job.
+func (s *Scraper) CreateCollector(job JobConfig, cacheDuration *time.Duration, cacheServeStale bool, collectUsage bool) *PrometheusCollector {
+	scrape, accounts := s.createScraper(job, cacheDuration, cacheServeStale, collectUsage)
+	return NewPrometheusCollector(scrape, WithRelabelConfigs(job.RelabelConfigs), WithClose(accounts.close))
+}
+
+// createScraper returns the scrape function of job and the resolver of its accounts
+func (s *Scraper) createScraper(job JobConfig, cacheDuration *time.Duration, cacheServeStale bool, collectUsage bool) (func() ([]*PrometheusMetric, error), *accountResolver) {
+	cacheServeStale = job.GetServeStale(cacheServeStale)
+	collectUsage = job.GetCollectUsage(collectUsage)
+
+	// create credentials, regions and caches of every account
+	accounts, setupErr := s.newAccountResolver(job, job.GetCacheDuration(*cacheDuration))
+	if setupErr != nil {
+		slog.Error("Invalid accounts", "serviceCode", job.ServiceCode, "error", setupErr)
+	}
 
-	cfg := s.getAWSConfig(job.Role)
-	AccountID := getAWSAccountID(cfg)
+	filter, err := newQuotaFilter(job.Include, job.Exclude)
+	if err != nil {
+		slog.Error("Invalid quota filter", "serviceCode", job.ServiceCode, "error", err)
+		setupErr = errors.Join(setupErr, err)
+	}
 
-	// create new cache for service
-	cacheStore, err := NewCache(job.ServiceCode, *cacheDuration)
+	services, err := newServiceResolver(job, s.discoveryInterval)
 	if err != nil {
-		slog.Warn(fmt.Sprintf("Cache disabled for %s (account %s)", job.ServiceCode, AccountID))
+		slog.Error("Invalid service codes", "serviceCode", job.ServiceCode, "error", err)
+		setupErr = errors.Join(setupErr, err)
+	}
+
+	// resolve discovered services at startup, they are refreshed during scrapes
+	if setupErr == nil && services.isDynamic() {
+		if _, err := services.ServiceCodes(context.Background(), accounts.discoveryConfig()); err != nil {
+			slog.Warn("Failed to discover services", "serviceCode", job.ServiceCode, "error", err)
+		}
 	}
 
 	return func() ([]*PrometheusMetric, error) {
-		// logging start metrics collection
-		l := slog.With("serviceCode", job.ServiceCode, "regions", job.Regions, logGroup)
-		start := time.Now()
-
-		if cacheStore != nil {
-			cacheData, err := cacheStore.Read()
-			if err == nil {
-				l.Debug("Metrics Read from cache",
-					"duration", time.Since(start),
-				)
-				return cacheData, nil
-			} else if err == ErrCacheEmpty {
-				l.Info("Cache Read", "msg", err)
-			} else if err == ErrCacheExpired {
-				l.Info("Cache Expired", "msg", err)
-				if cacheServeStale {
-					l.Info("Serving stale cache data")
-
-					if !cacheStore.ServeStale {
-						go s.scrapeServiceMetrics(l, job, AccountID, collectUsage, cacheStore)
-						cacheStore.ServeStale = true
-					}
-					return cacheData, nil
-				}
+		if setupErr != nil {
+			return nil, setupErr
+		}
+		serviceCodes, err := services.ServiceCodes(context.Background(), accounts.discoveryConfig())
+		if err != nil {
+			slog.Error("Failed to resolve services", "serviceCode", job.ServiceCode, "error", err, logGroup)
+			return nil, err
+		}
+		jobAccounts, err := accounts.Accounts(context.Background())
+		if err != nil {
+			slog.Error("Failed to resolve accounts", "serviceCode", job.ServiceCode, "error", err, logGroup)
+			return nil, err
+		}
 
-			} else {
-				l.Info("Cache Read Error", "error", err)
+		var (
+			wg      sync.WaitGroup
+			mutex   sync.Mutex
+			metrics = []*PrometheusMetric{}
+			errs    = []error{}
+		)
+		// accounts are scrapped concurrently, up to maxServiceConcurrency services of an account at once.
+		// An account failing (e.g. the role is missing) does not fail the others.
+		for _, account := range jobAccounts {
+			slots := make(chan struct{}, maxServiceConcurrency)
+			for _, serviceCode := range serviceCodes {
+				wg.Add(1)
+				go func(account *accountScraper, serviceCode string) {
+					defer wg.Done()
+					slots <- struct{}{}
+					defer func() { <-slots }()
+					serviceJob := job
+					serviceJob.ServiceCode = serviceCode
+					m, err := s.scrapeService(serviceJob, account, filter, collectUsage, cacheServeStale)
+					mutex.Lock()
+					defer mutex.Unlock()
+					if err != nil {
+						errs = append(errs, err)
+					} else {
+						metrics = append(metrics, m...)
+					}
+				}(account, serviceCode)
 			}
 		}
+		wg.Wait()
+
+		// partial results are served if at least one service was scrapped
+		if len(errs) > 0 && len(errs) == len(serviceCodes)*len(jobAccounts) {
+			return nil, errors.Join(errs...)
+		}
+		return metrics, nil
+	}, accounts
+}
 
-		return s.scrapeServiceMetrics(l, job, AccountID, collectUsage, cacheStore)
+// scrapeService returns the metrics of a single service of an account from cache, or scrapes them
+func (s *Scraper) scrapeService(job JobConfig, account *accountScraper, filter *quotaFilter, collectUsage bool, cacheServeStale bool) ([]*PrometheusMetric, error) {
+	// logging start metrics collection
+	l := slog.With("serviceCode", job.ServiceCode, "regions", job.Regions, "account", account.accountID, logGroup)
+	if job.Source != "" {
+		l = l.With("configFile", job.Source)
+	}
+	start := time.Now()
+
+	cacheStore := account.caches.get(job.ServiceCode)
+	if cacheStore != nil {
+		cacheData, err := cacheStore.Read()
+		if err == nil {
+			l.Debug("Metrics Read from cache",
+				"duration", time.Since(start),
+			)
+			return cacheData, nil
+		} else if err == ErrCacheEmpty {
+			l.Info("Cache Read", "msg", err)
+		} else if err == ErrCacheExpired {
+			l.Info("Cache Expired", "msg", err)
+			if cacheServeStale {
+				l.Info("Serving stale cache data")
+
+				if !cacheStore.ServeStale {
+					go s.scrapeServiceMetrics(l, job, account, filter, collectUsage, cacheStore)
+					cacheStore.ServeStale = true
+				}
+				return cacheData, nil
+			}
 
+		} else {
+			l.Info("Cache Read Error", "error", err)
+		}
 	}
 
+	return s.scrapeServiceMetrics(l, job, account, filter, collectUsage, cacheStore)
 }
 
-func (s *Scraper) scrapeServiceMetrics(l *slog.Logger, job JobConfig, AccountID string, collectUsage bool, cacheStore *Cache) ([]*PrometheusMetric, error) {
+func (s *Scraper) scrapeServiceMetrics(l *slog.Logger, job JobConfig, account *accountScraper, filter *quotaFilter, collectUsage bool, cacheStore *Cache) ([]*PrometheusMetric, error) {
 	start := time.Now()
 	l.Info("Scrapping metrics")
 
 	ctx := context.Background()
-	cfg := s.getAWSConfig(job.Role) // get credentials incase it expires
-	sqclient := sq.NewFromConfig(cfg)
-	cwclient := cw.NewFromConfig(cfg)
-	input := sq.ListServiceQuotasInput{ServiceCode: &job.ServiceCode, MaxResults: &maxResults}
+	cfg := account.cfg // credentials are refreshed by the credentials cache of the account
+	regions, err := account.regions.Regions(ctx, cfg)
+	if err != nil {
+		l.ErrorCtx(ctx, "Failed to resolve regions",
+			"error", err,
+		)
+		return nil, err
+	}
+	sqclient := sq.NewFromConfig(cfg, job.Endpoints.serviceQuotasOptions)
+	cwclient := cw.NewFromConfig(cfg, job.Endpoints.cloudWatchOptions)
 	metricList := []*PrometheusMetric{}
-	c := make(chan chanData)
+	c := make(chan chanData, len(regions))
 	// create goroutine workers
-	for _, region := range job.Regions {
+	for _, region := range regions {
 		jobRegionCfg := JobRegion{
 			Region:      region,
-			AccountName: job.AccountName,
-			AccountID:   AccountID,
+			AccountName: account.accountName,
+			AccountID:   account.accountID,
+			Labels:      job.Labels,
+			MetricNames: job.MetricNames,
+			Usage:       job.Usage,
 		}
-		go getServiceQuotas(ctx, collectUsage, jobRegionCfg, &input, sqclient, cwclient, c)
+		input := sq.ListServiceQuotasInput{ServiceCode: &job.ServiceCode, MaxResults: &maxResults}
+		go getServiceQuotas(ctx, collectUsage, jobRegionCfg, filter, &input, sqclient, cwclient, c)
 	}
 	// retrieve channel results from goroutines
-	for i := 0; i < len(job.Regions); i++ {
+	for i := 0; i < len(regions); i++ {
 		data := <-c
 		if data.err != nil {
 			l.ErrorCtx(ctx, "Failed to get service quotas",
@@ -152,6 +289,10 @@ func (s *Scraper) scrapeServiceMetrics(l *slog.Logger, job JobConfig, AccountID
 		metricList = append(metricList, data.metrics...)
 	}
 
+	if job.GetCollectRequests(s.collectRequests) {
+		metricList = append(metricList, scrapeQuotaRequests(ctx, l, job, account, regions, filter, sqclient)...)
+	}
+
 	if cacheStore != nil {
 		err := cacheStore.Write(metricList)
 		if err != nil {
@@ -165,7 +306,38 @@ func (s *Scraper) scrapeServiceMetrics(l *slog.Logger, job JobConfig, AccountID
 	return metricList, nil
 }
 
-func getAWSAccountID(cfg aws.Config) string {
+// scrapeQuotaRequests returns the quota increase requests kept by filter of every region,
+// a region failing (e.g. the permission is missing) is only logged
+func scrapeQuotaRequests(ctx context.Context, l *slog.Logger, job JobConfig, account *accountScraper, regions []string, filter *quotaFilter, client QuotaRequestsClient) []*PrometheusMetric {
+	var (
+		wg      sync.WaitGroup
+		mutex   sync.Mutex
+		metrics = []*PrometheusMetric{}
+	)
+	for _, region := range regions {
+		wg.Add(1)
+		go func(region string) {
+			defer wg.Done()
+			m, err := getQuotaRequests(ctx, client, job.ServiceCode, filter, JobRegion{
+				Region:      region,
+				AccountName: account.accountName,
+				AccountID:   account.accountID,
+				Labels:      job.Labels,
+			})
+			if err != nil {
+				l.WarnCtx(ctx, "Failed to get quota increase requests", "region", region, "error", err)
+				return
+			}
+			mutex.Lock()
+			metrics = append(metrics, m...)
+			mutex.Unlock()
+		}(region)
+	}
+	wg.Wait()
+	return metrics
+}
+
+func getAWSAccountID(cfg aws.Config, endpoints *EndpointsConfig) string {
 	opts := sts.Options{
 		APIOptions:   cfg.APIOptions,
 		Region:       cfg.Region,
@@ -173,7 +345,7 @@ func getAWSAccountID(cfg aws.Config) string {
 		DefaultsMode: cfg.DefaultsMode,
 	}
 
-	stssvc := sts.New(opts)
+	stssvc := sts.New(opts, endpoints.stsOptions)
 	input := &sts.GetCallerIdentityInput{}
 	ctx := context.Background()
 	caller, err := stssvc.GetCallerIdentity(ctx, input)
@@ -187,27 +359,26 @@ func getAWSAccountID(cfg aws.Config) string {
 
 }
 
-func (s *Scraper) getAWSConfig(role string) aws.Config {
-	if role == "" {
-		return s.cfg
+// getAWSConfig returns the configuration of job to assume role.
+// The default configuration is used unless the job sets a profile, errors are returned to fail only this job.
+func (s *Scraper) getAWSConfig(job JobConfig, role string) (aws.Config, error) {
+	if job.Profile == "" && role == "" {
+		return s.cfg, nil
 	}
-	if !validateRoleARN(role) {
-		slog.Error("Role ARN is not valid", "RoleARN", role)
-		os.Exit(1)
+	if role != "" && !validateRoleARN(role) {
+		return aws.Config{}, fmt.Errorf("invalid role ARN %q", role)
 	}
 	ctx := context.Background()
-	cfg, err := config.LoadDefaultConfig(ctx)
-
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithSharedConfigProfile(job.Profile))
 	if err != nil {
-		slog.ErrorCtx(ctx, "Error loading default AWS config", "error", err)
-		os.Exit(1)
+		return aws.Config{}, fmt.Errorf("loading AWS config (profile %q): %w", job.Profile, err)
+	}
+	if role == "" {
+		return cfg, nil
 	}
-	// Create the credentials from AssumeRoleProvider to assume the role
-	// referenced by the "myRoleARN" ARN.
-	stsSvc := sts.NewFromConfig(cfg)
-	creds := stscreds.NewAssumeRoleProvider(stsSvc, role)
-	cfg.Credentials = aws.NewCredentialsCache(creds)
-	return cfg
+	// Create the credentials from AssumeRoleProvider to assume the role,
+	// after the roles of the chain
+	return assumeRole(cfg, role, job.assumeRoleOptions(), newSTSClient(job.Endpoints)), nil
 }
 
 func validateRoleARN(role string) bool {
@@ -234,6 +405,11 @@ func Transform(quotas []QuotaUsage, collectUsage bool, jobRegionCfg JobRegion) (
 			quotaMetric = createPromMetric(quota, "quota", jobRegionCfg)
 			metrics = append(metrics, quotaMetric)
 
+			// if the AWS default value is known, create also the default metric
+			if quota.Default != nil {
+				metrics = append(metrics, createPromMetric(quota, "default", jobRegionCfg))
+			}
+
 			// if Quota has UsageMetric, create also _usage metric
 			if collectUsage && quota.Quota.UsageMetric != nil {
 				quotaUsage = createPromMetric(quota, "usage", jobRegionCfg)
@@ -241,19 +417,63 @@ func Transform(quotas []QuotaUsage, collectUsage bool, jobRegionCfg JobRegion) (
 			}
 		}
 	}
+	// utilization of grouped and single quotas, with the same labels
+	if collectUsage {
+		check := map[string]bool{}
+		for _, q := range quotas {
+			if q.Quota.UsageMetric == nil || check[*q.Quota.QuotaCode] {
+				continue
+			}
+			check[*q.Quota.QuotaCode] = true
+			metrics = append(metrics, createUtilizationMetrics(q, jobRegionCfg)...)
+		}
+	}
 	return metrics, nil
 }
 
+// createUtilizationMetrics creates the utilization ratio and headroom metrics of a quota with usage.
+// Both are skipped when the quota value or the usage is missing, the ratio is skipped when the quota value is 0.
+func createUtilizationMetrics(q QuotaUsage, jobRegionCfg JobRegion) []*PrometheusMetric {
+	if q.Quota.Value == nil || !q.HasUsage {
+		return nil
+	}
+	labels := func() map[string]string {
+		return withJobLabels(map[string]string{
+			"adjustable":   strconv.FormatBool(q.Quota.Adjustable),
+			"global_quota": strconv.FormatBool(q.Quota.GlobalQuota),
+			"unit":         aws.ToString(q.Quota.Unit),
+			"region":       jobRegionCfg.Region,
+			"account":      jobRegionCfg.AccountID,
+			"account_name": jobRegionCfg.AccountName,
+			"name":         aws.ToString(q.Quota.QuotaName),
+			"quota_code":   aws.ToString(q.Quota.QuotaCode),
+			"service_code": aws.ToString(q.Quota.ServiceCode),
+		}, jobRegionCfg.Labels)
+	}
+	value := *q.Quota.Value
+	metrics := []*PrometheusMetric{{
+		Name:   "aws_quota_headroom",
+		Value:  value - q.Usage,
+		Labels: labels(),
+		Desc:   "Quota value minus usage, negative when the usage exceeds the quota",
+	}}
+	if value != 0 {
+		metrics = append(metrics, &PrometheusMetric{
+			Name:   "aws_quota_utilization_ratio",
+			Value:  q.Usage / value,
+			Labels: labels(),
+			Desc:   "Usage divided by the quota value",
+		})
+	}
+	return metrics
+}
+
 // createPromMetric creates a Prometheus metric based on the given metric group (for single quotas).
 func createPromMetric(m MetricGroup, metricType string, jobRegionCfg JobRegion) *PrometheusMetric {
-	value := *m.Quota.Value
-	if metricType == "usage" {
-		value = m.Usage
-	}
-	return &PrometheusMetric{
+	return withMetricName(&PrometheusMetric{
 		Name:  createMetricName(*m.Quota.ServiceCode, *m.Quota.QuotaName),
-		Value: value,
-		Labels: map[string]string{
+		Value: m.value(metricType),
+		Labels: withJobLabels(map[string]string{
 			"type":         metricType,
 			"adjustable":   strconv.FormatBool(m.Quota.Adjustable),
 			"global_quota": strconv.FormatBool(m.Quota.GlobalQuota),
@@ -264,9 +484,54 @@ func createPromMetric(m MetricGroup, metricType string, jobRegionCfg JobRegion)
 			"quota_code":   *m.Quota.QuotaCode,
 			"service_code": *m.Quota.ServiceCode,
 			"account_name": jobRegionCfg.AccountName,
-		},
+		}, jobRegionCfg.Labels),
 		Desc: createDescription(*m.Quota.ServiceName, *m.Quota.QuotaName),
+	}, m.Quota, jobRegionCfg.MetricNames)
+}
+
+// builtinLabels are the labels of the quota metrics, they cannot be set by the static labels of a job
+var builtinLabels = []string{"type", "adjustable", "global_quota", "unit", "region", "account", "account_name", "kind", "name", "quota_code", "service_code",
+	"request_id", "case_id", "status", "desired_value"}
+
+// withJobLabels adds the static labels of a job to labels, the labels already set (e.g. builtinLabels) are kept
+func withJobLabels(labels, jobLabels map[string]string) map[string]string {
+	for k, v := range jobLabels {
+		if _, ok := labels[k]; !ok {
+			labels[k] = v
+		}
+	}
+	return labels
+}
+
+// QuotaMetric fixes the name of the metrics of a quota, whatever AWS returns as quota name
+type QuotaMetric struct {
+	Name   string            `yaml:"name" description:"Metric name of the quota." title:"metric name" pattern:"^[a-zA-Z_:][a-zA-Z0-9_:]*$"`
+	Help   string            `yaml:"help,omitempty" description:"Help of the metric, the quota name by default. Set the same help on quotas sharing a metric name."`
+	Labels map[string]string `yaml:"labels,omitempty" description:"Extra labels of the metrics of the quota."`
+}
+
+// quotaKey is the key of a quota in JobConfig.MetricNames
+func quotaKey(serviceCode, quotaCode string) string {
+	return serviceCode + "/" + quotaCode
+}
+
+// withMetricName sets the fixed name, help and labels of the metric of quota when it is in names
+func withMetricName(metric *PrometheusMetric, quota sqTypes.ServiceQuota, names map[string]QuotaMetric) *PrometheusMetric {
+	name, ok := names[quotaKey(aws.ToString(quota.ServiceCode), aws.ToString(quota.QuotaCode))]
+	if !ok {
+		return metric
+	}
+	metric.Name = name.Name
+	if name.Help != "" {
+		metric.Desc = name.Help
+	}
+	// the extra labels of the quota win over the static labels of the job, not over builtinLabels
+	for k, v := range name.Labels {
+		if !contains(builtinLabels, k) {
+			metric.Labels[k] = v
+		}
 	}
+	return metric
 }
 
 func createMetricName(serviceCode, quotaName string) string {
@@ -277,7 +542,7 @@ func createDescription(serviceName, quotaName string) string {
 	return fmt.Sprintf("%s: %s", serviceName, quotaName)
 }
 
-func getServiceQuotas(ctx context.Context, collectUsage bool, jobRegionCfg JobRegion, sqInput *sq.ListServiceQuotasInput, sqclient *sq.Client, cwclient CloudWatchClient, c chan chanData) {
+func getServiceQuotas(ctx context.Context, collectUsage bool, jobRegionCfg JobRegion, filter *quotaFilter, sqInput *sq.ListServiceQuotasInput, sqclient *sq.Client, cwclient CloudWatchClient, c chan chanData) {
 	sqOpts := func(o *sq.Options) { o.Region = jobRegionCfg.Region }
 	asqInput := &sq.ListAWSDefaultServiceQuotasInput{ServiceCode: sqInput.ServiceCode, MaxResults: &maxResults}
 	var wg sync.WaitGroup
@@ -313,12 +578,20 @@ func getServiceQuotas(ctx context.Context, collectUsage bool, jobRegionCfg JobRe
 	}
 
 	// merge applied Quotas with defaults
-	quotasMerged := append(r.Quotas, d.Quotas...)
+	quotasMerged, defaultValues := mergeQuotas(r.Quotas, d.Quotas)
+	// drop filtered quotas before collecting their usage
+	quotasMerged = filter.Filter(quotasMerged)
 	if collectUsage { // Collect quota usage if enabled
-		quotasUsage = getQuotasUsage(ctx, quotasMerged, cwclient, jobRegionCfg.Region)
+		quotasUsage = getQuotasUsage(ctx, quotasMerged, cwclient, jobRegionCfg.Region, jobRegionCfg.Usage)
 	} else { // Otherwise just create quotasUsage struct from quotasMerged
 		for _, q := range quotasMerged {
-			quotasUsage = append(quotasUsage, QuotaUsage{q, 0})
+			quotasUsage = append(quotasUsage, QuotaUsage{Quota: q})
+		}
+	}
+
+	for i, q := range quotasUsage {
+		if value, ok := defaultValues[aws.ToString(q.Quota.QuotaCode)]; ok {
+			quotasUsage[i].Default = aws.Float64(value)
 		}
 	}
 
@@ -330,6 +603,30 @@ func getServiceQuotas(ctx context.Context, collectUsage bool, jobRegionCfg JobRe
 	c <- data
 }
 
+// mergeQuotas merges the applied and the AWS default quotas by quota code, the applied quota always wins.
+// It also returns the AWS default values by quota code.
+func mergeQuotas(applied, defaults []sqTypes.ServiceQuota) ([]sqTypes.ServiceQuota, map[string]float64) {
+	defaultValues := map[string]float64{}
+	for _, q := range defaults {
+		if q.QuotaCode != nil && q.Value != nil {
+			defaultValues[*q.QuotaCode] = *q.Value
+		}
+	}
+	merged := make([]sqTypes.ServiceQuota, 0, len(applied)+len(defaults))
+	seen := map[string]bool{}
+	for _, quotas := range [][]sqTypes.ServiceQuota{applied, defaults} {
+		for _, q := range quotas {
+			code := aws.ToString(q.QuotaCode)
+			if seen[code] || q.Value == nil {
+				continue
+			}
+			seen[code] = true
+			merged = append(merged, q)
+		}
+	}
+	return merged, defaultValues
+}
+
 func getListServiceQuotas(ctx context.Context, client *sq.Client, opts func(o *sq.Options), sqInput *sq.ListServiceQuotasInput) (*sq.ListServiceQuotasOutput, error) {
 
 	r, err := client.ListServiceQuotas(ctx, sqInput, opts)
@@ -368,63 +665,132 @@ func getDefaultListServiceQuotas(ctx context.Context, client *sq.Client, opts fu
 	return r, nil
 }
 
-func getQuotasUsage(ctx context.Context, quotas []sqTypes.ServiceQuota, cwclient CloudWatchClient, region string) []QuotaUsage {
-	quotasUsage := []QuotaUsage{}
+// getQuotasUsage reads the usage of quotas from CloudWatch, with the window, period and statistic set by usage.
+// The queries sharing a window are batched in GetMetricData requests of up to maxMetricDataQueries queries.
+func getQuotasUsage(ctx context.Context, quotas []sqTypes.ServiceQuota, cwclient CloudWatchClient, region string, usage *UsageConfig) []QuotaUsage {
+	quotasUsage := make([]QuotaUsage, 0, len(quotas))
+	batches := map[time.Duration][]usageRequest{} // requests by window
 	check := map[string]bool{}
+	for i, q := range quotas {
+		quotasUsage = append(quotasUsage, QuotaUsage{Quota: q})
+		if q.UsageMetric == nil || check[*q.QuotaCode] {
+			continue
+		}
+		check[*q.QuotaCode] = true
+		query := usage.query(q)
+		if query.statistic == "" || q.UsageMetric.MetricName == nil || q.UsageMetric.MetricNamespace == nil {
+			slog.Debug("Skipping usage without metric or statistic", "QuotaCode", *q.QuotaCode)
+			continue
+		}
+		batches[query.lookback] = append(batches[query.lookback], usageRequest{index: i, query: query})
+	}
+
 	cwOpts := func(o *cw.Options) { o.Region = region }
-	for _, q := range quotas {
-		mq := QuotaUsage{q, 0}
-		if q.UsageMetric != nil && !check[*q.QuotaCode] {
-			var dimensions []cwTypes.Dimension
-			var cloudwatchTimePeriod = defaultCloudwatchTimePeriod
-			if *q.ServiceCode == "rds" {
-				cloudwatchTimePeriod = 75 // minutes, increased due to delay in RDS usage metrics reporting
+	now := time.Now()
+	for lookback, requests := range batches {
+		for start := 0; start < len(requests); start += maxMetricDataQueries {
+			batch := requests[start:min(start+maxMetricDataQueries, len(requests))]
+			values, calls, err := getMetricData(ctx, cwclient, cwOpts, now.Add(-lookback), now, quotas, batch)
+			if err != nil {
+				slog.Warn("Unable to retrieve CloudWatch usage", "error", err)
+				cloudWatchFailedBatches.Inc()
+				continue
 			}
-			for k, v := range q.UsageMetric.MetricDimensions { // form Dimensions filter for GetMetricStatisticsInput based on UsageMetric.MetricDimensions
-				dimensions = append(dimensions, cwTypes.Dimension{Name: aws.String(k), Value: aws.String(v)})
+			if saved := len(batch) - calls; saved > 0 {
+				cloudWatchCallsSaved.Add(float64(saved))
 			}
-			params := &cw.GetMetricStatisticsInput{
-				MetricName: aws.String(*q.UsageMetric.MetricName),
-				Namespace:  aws.String(*q.UsageMetric.MetricNamespace),
-				StartTime:  aws.Time(time.Now().Add(time.Minute * -time.Duration(cloudwatchTimePeriod))),
-				EndTime:    aws.Time(time.Now()),
-				Period:     aws.Int32(60 * cloudwatchTimePeriod),
-				Dimensions: dimensions,
-				Statistics: []cwTypes.Statistic{cwTypes.Statistic(*q.UsageMetric.MetricStatisticRecommendation)},
+			for i, value := range values { // quotas without datapoints keep a usage of 0, without HasUsage
+				r := batch[i]
+				quotasUsage[r.index].Usage = usageValue(value, quotas[r.index], r.query)
+				quotasUsage[r.index].HasUsage = true
 			}
-			resp, err := cwclient.GetMetricStatistics(ctx, params, cwOpts)
-
-			if err == nil {
-				if len(resp.Datapoints) > 0 { // if Quota has Usage, it will be set, otherwise it's = 0
-					switch *q.UsageMetric.MetricStatisticRecommendation {
-					case "Maximum":
-						mq.Usage = *resp.Datapoints[0].Maximum
-					case "Minimum":
-						mq.Usage = *resp.Datapoints[0].Minimum
-					case "Average":
-						mq.Usage = *resp.Datapoints[0].Average
-					case "Sum":
-						var periodSeconds float64
-						periodValue := float64(*q.Period.PeriodValue)
-						switch q.Period.PeriodUnit { // convert PeriodUnit to seconds
-						case sqTypes.PeriodUnitSecond:
-							periodSeconds = 1
-						case sqTypes.PeriodUnitMinute:
-							periodSeconds = 60
-						default:
-							slog.Warn("Unable to convert PeriodUnit to seconds", "QuotaCode", *q.QuotaCode, "PeriodUnit", q.Period.PeriodUnit)
-						}
-						mq.Usage = (*resp.Datapoints[0].Sum * periodSeconds * periodValue) / float64(cloudwatchTimePeriod*60) // Sum is calculated over cloudwatchTimePeriod interval
-					case "SampleCount":
-						mq.Usage = *resp.Datapoints[0].SampleCount
-					}
+		}
+	}
+	return quotasUsage
+}
+
+// usageRequest is the usage query of the quota at index in the quotas of getQuotasUsage
+type usageRequest struct {
+	index int
+	query usageQuery
+}
+
+// getMetricData returns the latest value of every request by index in batch, following the pages of the results.
+// It also returns the number of GetMetricData calls.
+func getMetricData(ctx context.Context, cwclient CloudWatchClient, cwOpts func(o *cw.Options), startTime, endTime time.Time, quotas []sqTypes.ServiceQuota, batch []usageRequest) (map[int]float64, int, error) {
+	queries := make([]cwTypes.MetricDataQuery, 0, len(batch))
+	for i, r := range batch {
+		metric := quotas[r.index].UsageMetric
+		var dimensions []cwTypes.Dimension
+		for k, v := range metric.MetricDimensions { // form Dimensions filter based on UsageMetric.MetricDimensions
+			dimensions = append(dimensions, cwTypes.Dimension{Name: aws.String(k), Value: aws.String(v)})
+		}
+		queries = append(queries, cwTypes.MetricDataQuery{
+			Id: aws.String(fmt.Sprintf("q%d", i)),
+			MetricStat: &cwTypes.MetricStat{
+				Metric: &cwTypes.Metric{
+					MetricName: metric.MetricName,
+					Namespace:  metric.MetricNamespace,
+					Dimensions: dimensions,
+				},
+				Period: aws.Int32(int32(r.query.period.Seconds())),
+				Stat:   aws.String(r.query.statistic),
+			},
+			ReturnData: aws.Bool(true),
+		})
+	}
+	params := &cw.GetMetricDataInput{
+		MetricDataQueries: queries,
+		StartTime:         aws.Time(startTime),
+		EndTime:           aws.Time(endTime),
+	}
+
+	values := map[int]float64{}
+	latest := map[int]time.Time{}
+	calls := 0
+	for {
+		resp, err := cwclient.GetMetricData(ctx, params, cwOpts)
+		calls++
+		if err != nil {
+			return nil, calls, err
+		}
+		for _, result := range resp.MetricDataResults {
+			var i int
+			if _, err := fmt.Sscanf(aws.ToString(result.Id), "q%d", &i); err != nil || i >= len(batch) {
+				continue
+			}
+			// the window can hold several periods, the latest datapoint is used
+			for j, value := range result.Values {
+				if j >= len(result.Timestamps) {
+					break
+				}
+				if t, ok := latest[i]; !ok || result.Timestamps[j].After(t) {
+					latest[i] = result.Timestamps[j]
+					values[i] = value
 				}
-			} else {
-				slog.Warn("Unable to retrieve CloudWatch usage", "error", err)
 			}
-			check[*q.QuotaCode] = true
 		}
-		quotasUsage = append(quotasUsage, mq)
+		if resp.NextToken == nil {
+			return values, calls, nil
+		}
+		params.NextToken = resp.NextToken
 	}
-	return quotasUsage
+}
+
+// usageValue returns the usage of quota from the value of the statistic of query
+func usageValue(value float64, q sqTypes.ServiceQuota, query usageQuery) float64 {
+	if query.statistic != "Sum" || q.Period == nil {
+		return value
+	}
+	var periodSeconds float64
+	periodValue := float64(aws.ToInt32(q.Period.PeriodValue))
+	switch q.Period.PeriodUnit { // convert PeriodUnit to seconds
+	case sqTypes.PeriodUnitSecond:
+		periodSeconds = 1
+	case sqTypes.PeriodUnitMinute:
+		periodSeconds = 60
+	default:
+		slog.Warn("Unable to convert PeriodUnit to seconds", "QuotaCode", *q.QuotaCode, "PeriodUnit", q.Period.PeriodUnit)
+	}
+	return (value * periodSeconds * periodValue) / query.period.Seconds() // Sum is calculated over the CloudWatch period
 }
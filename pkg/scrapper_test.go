@@ -23,6 +23,19 @@ func Int32(v int32) *int32 {
 	return &v
 }
 
+func (m *MockCloudWatchClient) GetMetricData(ctx context.Context, params *cw.GetMetricDataInput, optFns ...func(*cw.Options)) (*cw.GetMetricDataOutput, error) {
+	values := map[string]float64{"Average": 50, "Sum": 1800}
+	out := &cw.GetMetricDataOutput{}
+	for _, q := range params.MetricDataQueries {
+		out.MetricDataResults = append(out.MetricDataResults, cwTypes.MetricDataResult{
+			Id:         q.Id,
+			Timestamps: []time.Time{time.Now()},
+			Values:     []float64{values[*q.MetricStat.Stat]},
+		})
+	}
+	return out, nil
+}
+
 func (m *MockCloudWatchClient) GetMetricStatistics(ctx context.Context, params *cw.GetMetricStatisticsInput, optFns ...func(*cw.Options)) (*cw.GetMetricStatisticsOutput, error) {
 	return &cw.GetMetricStatisticsOutput{
 		Datapoints: []cwTypes.Datapoint{
@@ -232,7 +245,8 @@ func Test_getQuotasUsage(t *testing.T) {
 							MetricStatisticRecommendation: aws.String("Average"),
 						},
 					},
-					Usage: 50, // This should be set to the actual usage value from the mock CloudWatch client
+					Usage:    50, // This should be set to the actual usage value from the mock CloudWatch client
+					HasUsage: true,
 				},
 			},
 		},
@@ -272,7 +286,8 @@ func Test_getQuotasUsage(t *testing.T) {
 						},
 						Period: &sqTypes.QuotaPeriod{PeriodUnit: sqTypes.PeriodUnitSecond, PeriodValue: Int32(1)},
 					},
-					Usage: 2, // This should be set to the function result based on data from the mock CloudWatch client
+					Usage:    2, // This should be set to the function result based on data from the mock CloudWatch client
+					HasUsage: true,
 				},
 			},
 		},
@@ -312,7 +327,8 @@ func Test_getQuotasUsage(t *testing.T) {
 						},
 						Period: &sqTypes.QuotaPeriod{PeriodUnit: sqTypes.PeriodUnitMinute, PeriodValue: Int32(5)},
 					},
-					Usage: 600, // This should be set to the function result based on data from the mock CloudWatch client
+					Usage:    600, // This should be set to the function result based on data from the mock CloudWatch client
+					HasUsage: true,
 				},
 			},
 		},
@@ -321,10 +337,190 @@ func Test_getQuotasUsage(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockCWClient := &MockCloudWatchClient{}
-			got := getQuotasUsage(tt.args.ctx, tt.args.quotas, mockCWClient, tt.args.region)
+			got := getQuotasUsage(tt.args.ctx, tt.args.quotas, mockCWClient, tt.args.region, nil)
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("getQuotasUsage() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+// newQuotaUsage returns an ec2 quota with a value of 100, changed by opts
+func newQuotaUsage(code, name string, opts ...func(*QuotaUsage)) QuotaUsage {
+	q := QuotaUsage{Quota: sqTypes.ServiceQuota{
+		ServiceCode: aws.String("ec2"),
+		ServiceName: aws.String("Amazon Elastic Compute Cloud"),
+		QuotaCode:   aws.String(code),
+		QuotaName:   aws.String(name),
+		Value:       aws.Float64(100),
+		Unit:        aws.String("None"),
+	}}
+	for _, opt := range opts {
+		opt(&q)
+	}
+	return q
+}
+
+// withValue sets the applied value of the quota
+func withValue(value float64) func(*QuotaUsage) {
+	return func(q *QuotaUsage) { q.Quota.Value = aws.Float64(value) }
+}
+
+// withDefault sets the default value of the quota
+func withDefault(value float64) func(*QuotaUsage) {
+	return func(q *QuotaUsage) { q.Default = aws.Float64(value) }
+}
+
+// withUsage sets the usage metric and the usage of the quota
+func withUsage(usage float64) func(*QuotaUsage) {
+	return func(q *QuotaUsage) {
+		q.Quota.UsageMetric = &sqTypes.MetricInfo{MetricName: aws.String("ResourceCount")}
+		q.Usage, q.HasUsage = usage, true
+	}
+}
+
+func TestTransform_Labels(t *testing.T) {
+	quotas := []QuotaUsage{
+		newQuotaUsage("L-1", "All DL Spot Instance Requests"),
+		newQuotaUsage("L-2", "All F Spot Instance Requests"),
+		newQuotaUsage("L-3", "Running Dedicated Hosts"),
+	}
+	// a built-in label set by the job (without validation) is ignored
+	jobRegionCfg := JobRegion{Region: "us-west-2", AccountID: "123456789012", Labels: map[string]string{"team": "payments", "env": "prod", "region": "eu-west-1"}}
+	metrics, err := Transform(quotas, false, jobRegionCfg)
+	if err != nil {
+		t.Fatalf("Transform() error = %v", err)
+	}
+	grouped := 0
+	for _, m := range metrics {
+		if m.Labels["kind"] != "" {
+			grouped++
+		}
+		if m.Labels["team"] != "payments" || m.Labels["env"] != "prod" || m.Labels["region"] != "us-west-2" {
+			t.Errorf("%s labels = %v, want the job labels", m.Name, m.Labels)
+		}
+	}
+	if len(metrics) != 3 || grouped != 2 {
+		t.Errorf("Transform() = %d metrics with %d grouped, want 3 with 2 grouped", len(metrics), grouped)
+	}
+}
+
+func TestTransform_MetricNames(t *testing.T) {
+	quotas := []QuotaUsage{
+		newQuotaUsage("L-1", "All DL Spot Instance Requests"),
+		newQuotaUsage("L-2", "All F Spot Instance Requests (renamed)"),
+		newQuotaUsage("L-3", "Running Dedicated Hosts"),
+	}
+	jobRegionCfg := JobRegion{Region: "us-west-2", Labels: map[string]string{"family": "all"}, MetricNames: map[string]QuotaMetric{
+		"ec2/L-2": {Name: "aws_quota_ec2_f_spot_instance_requests", Help: "F spot instance requests", Labels: map[string]string{"family": "f", "quota_code": "L-F"}},
+		"ec2/L-3": {Name: "aws_quota_ec2_dedicated_hosts"},
+		"rds/L-3": {Name: "aws_quota_rds_other"},
+	}}
+	metrics, err := Transform(quotas, false, jobRegionCfg)
+	if err != nil {
+		t.Fatalf("Transform() error = %v", err)
+	}
+	got := map[string]*PrometheusMetric{}
+	for _, m := range metrics {
+		got[m.Labels["quota_code"]] = m
+	}
+	if m := got["L-2"]; m == nil || m.Name != "aws_quota_ec2_f_spot_instance_requests" || m.Desc != "F spot instance requests" || m.Labels["family"] != "f" {
+		t.Errorf("L-2 metric = %+v, want the fixed name, help and labels", m)
+	}
+	if m := got["L-3"]; m == nil || m.Name != "aws_quota_ec2_dedicated_hosts" || m.Desc != "Amazon Elastic Compute Cloud: Running Dedicated Hosts" {
+		t.Errorf("L-3 metric = %+v, want the fixed name", m)
+	}
+	if m := got["L-1"]; m == nil || m.Name == "aws_quota_ec2_f_spot_instance_requests" {
+		t.Errorf("L-1 metric = %+v, want the generated name", m)
+	}
+}
+
+func Test_mergeQuotas(t *testing.T) {
+	quota := func(code string, value float64) sqTypes.ServiceQuota {
+		return sqTypes.ServiceQuota{QuotaCode: aws.String(code), Value: aws.Float64(value)}
+	}
+	applied := []sqTypes.ServiceQuota{quota("L-1", 200), quota("L-2", 10)}
+	defaults := []sqTypes.ServiceQuota{quota("L-3", 5), quota("L-1", 100), quota("L-2", 10)}
+
+	merged, defaultValues := mergeQuotas(applied, defaults)
+	got := map[string]float64{}
+	for _, q := range merged {
+		got[*q.QuotaCode] = *q.Value
+	}
+	if want := map[string]float64{"L-1": 200, "L-2": 10, "L-3": 5}; len(merged) != 3 || !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeQuotas() = %v, want %v", got, want)
+	}
+	if want := map[string]float64{"L-1": 100, "L-2": 10, "L-3": 5}; !reflect.DeepEqual(defaultValues, want) {
+		t.Errorf("mergeQuotas() defaults = %v, want %v", defaultValues, want)
+	}
+}
+
+func TestTransform_Default(t *testing.T) {
+	quotas := []QuotaUsage{
+		newQuotaUsage("L-1", "All DL Spot Instance Requests", withValue(200), withDefault(100)),
+		newQuotaUsage("L-2", "All F Spot Instance Requests", withDefault(100)),
+		newQuotaUsage("L-3", "Running Dedicated Hosts", withValue(50), withDefault(10)),
+		newQuotaUsage("L-4", "Elastic IPs", withValue(5)),
+	}
+	metrics, err := Transform(quotas, false, JobRegion{Region: "us-west-2"})
+	if err != nil {
+		t.Fatalf("Transform() error = %v", err)
+	}
+	got := map[string]float64{}
+	for _, m := range metrics {
+		got[m.Labels["quota_code"]+"/"+m.Labels["type"]] = m.Value
+	}
+	want := map[string]float64{
+		"L-1/quota": 200, "L-1/default": 100,
+		"L-2/quota": 100, "L-2/default": 100,
+		"L-3/quota": 50, "L-3/default": 10,
+		"L-4/quota": 5,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Transform() = %v, want %v", got, want)
+	}
+}
+
+func TestTransform_Utilization(t *testing.T) {
+	missing := newQuotaUsage("L-5", "EC2-VPC Elastic IPs", withValue(5), withUsage(0))
+	missing.HasUsage = false // no datapoint or a failed CloudWatch request
+	quotas := []QuotaUsage{
+		// grouped quotas
+		newQuotaUsage("L-1", "All DL Spot Instance Requests", withValue(200), withUsage(50)),
+		newQuotaUsage("L-2", "All F Spot Instance Requests", withUsage(100)),
+		// single quotas
+		newQuotaUsage("L-3", "Running Dedicated Hosts", withValue(10), withUsage(12)),
+		newQuotaUsage("L-4", "Elastic IPs", withValue(0), withUsage(0)),
+		missing,
+	}
+	metrics, err := Transform(quotas, true, JobRegion{Region: "us-west-2", Labels: map[string]string{"team": "platform"}})
+	if err != nil {
+		t.Fatalf("Transform() error = %v", err)
+	}
+	got := map[string]float64{}
+	for _, m := range metrics {
+		if m.Name != "aws_quota_utilization_ratio" && m.Name != "aws_quota_headroom" {
+			continue
+		}
+		if _, ok := m.Labels["kind"]; ok || len(m.Labels) != 10 || m.Labels["team"] != "platform" {
+			t.Errorf("%s labels = %v, want the same labels for grouped and single quotas", m.Name, m.Labels)
+		}
+		got[m.Name+"/"+m.Labels["quota_code"]] = m.Value
+	}
+	want := map[string]float64{
+		"aws_quota_utilization_ratio/L-1": 0.25, "aws_quota_headroom/L-1": 150,
+		"aws_quota_utilization_ratio/L-2": 1, "aws_quota_headroom/L-2": 0,
+		"aws_quota_utilization_ratio/L-3": 1.2, "aws_quota_headroom/L-3": -2,
+		"aws_quota_headroom/L-4": 0,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Transform() = %v, want %v", got, want)
+	}
+
+	metrics, _ = Transform(quotas[:1], false, JobRegion{Region: "us-west-2"})
+	for _, m := range metrics {
+		if m.Name == "aws_quota_utilization_ratio" || m.Name == "aws_quota_headroom" {
+			t.Errorf("Transform() without usage = %v", m)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package pkg
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// metrics of the exporter itself
+var (
+	cloudWatchCallsSaved = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "aqe_cloudwatch_calls_saved_total",
+		Help: "CloudWatch calls saved by batching the usage queries in GetMetricData requests, compared to one call per quota",
+	})
+	cloudWatchFailedBatches = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "aqe_cloudwatch_failed_batches_total",
+		Help: "GetMetricData batches of usage queries that failed, their quotas are exported without usage",
+	})
+	awsThrottles = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "aqe_aws_api_throttles_total",
+		Help: "AWS API calls throttled (e.g. TooManyRequestsException), by API and account",
+	}, []string{"service", "operation", "account"})
+	awsRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "aqe_aws_api_retries_total",
+		Help: "AWS API calls retried by the SDK, by API and account",
+	}, []string{"service", "operation", "account"})
+)
+
+// SelfCollectors returns the collectors of the metrics of the exporter itself
+func SelfCollectors() []prometheus.Collector {
+	return []prometheus.Collector{cloudWatchCallsSaved, cloudWatchFailedBatches, awsThrottles, awsRetries}
+}
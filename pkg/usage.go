@@ -0,0 +1,83 @@
+package pkg
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sqTypes "github.com/aws/aws-sdk-go-v2/service/servicequotas/types"
+)
+
+// defaultUsageLookback is the CloudWatch window of the usage, there can be up to 15 min delay in CloudWatch
+const defaultUsageLookback = 15 * time.Minute
+
+// defaultServiceUsageLookback are the windows of the services reporting their usage late
+var defaultServiceUsageLookback = map[string]time.Duration{
+	"rds": 75 * time.Minute, // increased due to delay in RDS usage metrics reporting
+}
+
+// UsageOptions sets how the usage of quotas is read from CloudWatch
+type UsageOptions struct {
+	Lookback  time.Duration `yaml:"lookback,omitempty" description:"CloudWatch window of the usage, 15m by default (75m for rds)."`
+	Period    time.Duration `yaml:"period,omitempty" description:"CloudWatch period of the usage, a multiple of 1m, the lookback by default."`
+	Statistic string        `yaml:"statistic,omitempty" description:"CloudWatch statistic of the usage, the statistic recommended by AWS by default." title:"usage statistic" enum:"Maximum,Minimum,Average,Sum,SampleCount"`
+}
+
+// UsageConfig sets how the usage of quotas is read from CloudWatch for every quota of a job,
+// with overrides by service code and by serviceCode/quotaCode
+type UsageConfig struct {
+	UsageOptions `yaml:",inline"`
+	Services     map[string]UsageOptions `yaml:"services,omitempty" description:"Usage options by service code."`
+	Quotas       map[string]UsageOptions `yaml:"quotas,omitempty" description:"Usage options by serviceCode/quotaCode."`
+}
+
+// usageQuery is the CloudWatch query of the usage of a quota
+type usageQuery struct {
+	lookback  time.Duration
+	period    time.Duration
+	statistic string
+}
+
+// query returns the usage query of quota, the options of the quota win over the options of its service,
+// the default window of the service (e.g. rds) and the options of the job
+func (u *UsageConfig) query(quota sqTypes.ServiceQuota) usageQuery {
+	q := u.resolve(aws.ToString(quota.ServiceCode), aws.ToString(quota.QuotaCode))
+	if q.statistic == "" && quota.UsageMetric != nil {
+		q.statistic = aws.ToString(quota.UsageMetric.MetricStatisticRecommendation)
+	}
+	return q
+}
+
+// resolve returns the usage query of the quota quotaCode of serviceCode without the statistic recommended by AWS
+func (u *UsageConfig) resolve(serviceCode, quotaCode string) usageQuery {
+	if u == nil {
+		u = &UsageConfig{}
+	}
+	levels := []UsageOptions{
+		u.Quotas[quotaKey(serviceCode, quotaCode)],
+		u.Services[serviceCode],
+	}
+	if lookback, ok := defaultServiceUsageLookback[serviceCode]; ok {
+		levels = append(levels, UsageOptions{Lookback: lookback})
+	}
+	levels = append(levels, u.UsageOptions)
+
+	q := usageQuery{}
+	for _, level := range levels {
+		if q.lookback == 0 {
+			q.lookback = level.Lookback
+		}
+		if q.period == 0 {
+			q.period = level.Period
+		}
+		if q.statistic == "" {
+			q.statistic = level.Statistic
+		}
+	}
+	if q.lookback == 0 {
+		q.lookback = defaultUsageLookback
+	}
+	if q.period == 0 {
+		q.period = q.lookback
+	}
+	return q
+}
@@ -0,0 +1,172 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cw "github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwTypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	sqTypes "github.com/aws/aws-sdk-go-v2/service/servicequotas/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func usageQuota(serviceCode, quotaCode string) sqTypes.ServiceQuota {
+	return sqTypes.ServiceQuota{
+		ServiceCode: aws.String(serviceCode),
+		QuotaCode:   aws.String(quotaCode),
+		QuotaName:   aws.String("Test Quota"),
+		Value:       aws.Float64(100),
+		UsageMetric: &sqTypes.MetricInfo{
+			MetricName:                    aws.String("ResourceCount"),
+			MetricNamespace:               aws.String("AWS/Usage"),
+			MetricStatisticRecommendation: aws.String("Maximum"),
+		},
+	}
+}
+
+func TestUsageConfig_query(t *testing.T) {
+	usage := &UsageConfig{
+		UsageOptions: UsageOptions{Lookback: 30 * time.Minute, Statistic: "Average"},
+		Services: map[string]UsageOptions{
+			"ec2": {Period: 5 * time.Minute},
+		},
+		Quotas: map[string]UsageOptions{
+			"ec2/L-1": {Lookback: time.Hour, Statistic: "Maximum"},
+			"rds/L-1": {Period: 15 * time.Minute},
+		},
+	}
+	tests := []struct {
+		name  string
+		usage *UsageConfig
+		quota sqTypes.ServiceQuota
+		want  usageQuery
+	}{
+		{name: "defaults", quota: usageQuota("lambda", "L-1"), want: usageQuery{15 * time.Minute, 15 * time.Minute, "Maximum"}},
+		{name: "rds default", quota: usageQuota("rds", "L-1"), want: usageQuery{75 * time.Minute, 75 * time.Minute, "Maximum"}},
+		{name: "job", usage: usage, quota: usageQuota("lambda", "L-1"), want: usageQuery{30 * time.Minute, 30 * time.Minute, "Average"}},
+		{name: "service", usage: usage, quota: usageQuota("ec2", "L-2"), want: usageQuery{30 * time.Minute, 5 * time.Minute, "Average"}},
+		{name: "quota", usage: usage, quota: usageQuota("ec2", "L-1"), want: usageQuery{time.Hour, 5 * time.Minute, "Maximum"}},
+		{name: "rds default wins over the job", usage: usage, quota: usageQuota("rds", "L-1"), want: usageQuery{75 * time.Minute, 15 * time.Minute, "Average"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.usage.query(tt.quota); got != tt.want {
+				t.Errorf("query() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// MockUsageCloudWatchClient records the GetMetricData calls and returns two datapoints per query,
+// the results are split in pages of pageSize results
+type MockUsageCloudWatchClient struct {
+	CloudWatchClient
+	pageSize int
+	err      error
+	params   []*cw.GetMetricDataInput
+}
+
+func (m *MockUsageCloudWatchClient) GetMetricData(ctx context.Context, params *cw.GetMetricDataInput, optFns ...func(*cw.Options)) (*cw.GetMetricDataOutput, error) {
+	input := *params
+	m.params = append(m.params, &input)
+	if m.err != nil {
+		return nil, m.err
+	}
+	now := time.Now()
+	values := map[string][]float64{"Maximum": {20, 10}, "Sum": {300, 600}}
+	results := []cwTypes.MetricDataResult{}
+	for _, q := range params.MetricDataQueries {
+		results = append(results, cwTypes.MetricDataResult{
+			Id:         q.Id,
+			Timestamps: []time.Time{now.Add(-5 * time.Minute), now.Add(-10 * time.Minute)},
+			Values:     values[*q.MetricStat.Stat],
+		})
+	}
+	start := 0
+	if params.NextToken != nil {
+		start, _ = strconv.Atoi(*params.NextToken)
+	}
+	out := &cw.GetMetricDataOutput{MetricDataResults: results[start:]}
+	if m.pageSize > 0 && start+m.pageSize < len(results) {
+		out.MetricDataResults = results[start : start+m.pageSize]
+		out.NextToken = aws.String(strconv.Itoa(start + m.pageSize))
+	}
+	return out, nil
+}
+
+func Test_getQuotasUsage_Options(t *testing.T) {
+	sum := usageQuota("ec2", "L-2")
+	sum.Period = &sqTypes.QuotaPeriod{PeriodUnit: sqTypes.PeriodUnitSecond, PeriodValue: Int32(1)}
+	usage := &UsageConfig{
+		UsageOptions: UsageOptions{Lookback: 20 * time.Minute, Period: 5 * time.Minute},
+		Quotas:       map[string]UsageOptions{"ec2/L-2": {Statistic: "Sum"}},
+	}
+	client := &MockUsageCloudWatchClient{}
+	got := getQuotasUsage(context.TODO(), []sqTypes.ServiceQuota{usageQuota("ec2", "L-1"), sum}, client, "us-west-2", usage)
+
+	// the latest datapoint is used, Sum is per second over the period
+	if got[0].Usage != 20 || got[1].Usage != 1 {
+		t.Errorf("getQuotasUsage() usage = %v and %v, want 20 and 1", got[0].Usage, got[1].Usage)
+	}
+	if len(client.params) != 1 {
+		t.Fatalf("GetMetricData() calls = %d, want 1", len(client.params))
+	}
+	params := client.params[0]
+	stat := params.MetricDataQueries[1].MetricStat
+	if window := params.EndTime.Sub(*params.StartTime); window != 20*time.Minute || *stat.Period != 300 || *stat.Stat != "Sum" {
+		t.Errorf("GetMetricData() window = %s, period = %d, statistic = %s", window, *stat.Period, *stat.Stat)
+	}
+}
+
+func Test_getQuotasUsage_Batches(t *testing.T) {
+	quotas := []sqTypes.ServiceQuota{}
+	for i := 0; i < 1200; i++ {
+		quotas = append(quotas, usageQuota("ec2", fmt.Sprintf("L-%d", i)))
+	}
+	// rds quotas are read over a longer window, in their own request
+	quotas = append(quotas, usageQuota("rds", "L-7B6409FD"))
+	client := &MockUsageCloudWatchClient{pageSize: 100}
+	saved := testutil.ToFloat64(cloudWatchCallsSaved)
+
+	got := getQuotasUsage(context.TODO(), quotas, client, "us-west-2", nil)
+	for i, q := range got {
+		if q.Usage != 20 {
+			t.Fatalf("getQuotasUsage() usage of %s = %v, want 20", *quotas[i].QuotaCode, q.Usage)
+		}
+	}
+	requests := map[int]int{} // queries by request
+	for _, params := range client.params {
+		if params.NextToken == nil {
+			requests[len(params.MetricDataQueries)]++
+		}
+	}
+	if want := map[int]int{500: 2, 200: 1, 1: 1}; !reflect.DeepEqual(requests, want) {
+		t.Errorf("GetMetricData() requests = %v, want %v", requests, want)
+	}
+	// 1201 quotas in 4 requests of 5, 5, 2 and 1 pages
+	if got := testutil.ToFloat64(cloudWatchCallsSaved) - saved; got != 1201-13 {
+		t.Errorf("%s = %v, want %v", "aqe_cloudwatch_calls_saved_total", got, 1201-13)
+	}
+}
+
+func Test_getQuotasUsage_FailedBatch(t *testing.T) {
+	client := &MockUsageCloudWatchClient{err: errors.New("AccessDenied")}
+	failed := testutil.ToFloat64(cloudWatchFailedBatches)
+
+	got := getQuotasUsage(context.TODO(), []sqTypes.ServiceQuota{usageQuota("ec2", "L-1"), usageQuota("rds", "L-7B6409FD")}, client, "us-west-2", nil)
+	for _, q := range got {
+		if q.HasUsage {
+			t.Errorf("getQuotasUsage() usage of %s = %v, want no usage", *q.Quota.QuotaCode, q.Usage)
+		}
+	}
+	// ec2 and rds are read over different windows, in 2 requests
+	if got := testutil.ToFloat64(cloudWatchFailedBatches) - failed; got != 2 {
+		t.Errorf("%s = %v, want 2", "aqe_cloudwatch_failed_batches_total", got)
+	}
+}
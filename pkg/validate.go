@@ -0,0 +1,372 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v3"
+)
+
+var yamlErrorRegexp = regexp.MustCompile(`^line (\d+): (.*)$`)
+
+// accountIDRegexp matches the account id action of a role template
+var accountIDRegexp = regexp.MustCompile(`\{\{-?\s*\.AccountID\s*-?\}\}`)
+
+const (
+	minSessionDuration = 15 * time.Minute
+	maxSessionDuration = 12 * time.Hour
+	// maxChainedSessionDuration is the AWS limit of the sessions of roles assumed with the credentials of a role
+	maxChainedSessionDuration = time.Hour
+)
+
+// ConfigError is a problem found in the configuration file
+type ConfigError struct {
+	File string // empty when the configuration is a single file
+	Line int
+	Msg  string
+}
+
+func (e ConfigError) Error() string {
+	if e.File != "" && e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+	}
+	if e.File != "" {
+		return fmt.Sprintf("%s: %s", e.File, e.Msg)
+	}
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+	}
+	return e.Msg
+}
+
+// ConfigErrors lists every problem found in the configuration file
+type ConfigErrors []ConfigError
+
+func (e ConfigErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("invalid configuration:\n  %s", strings.Join(msgs, "\n  "))
+}
+
+// typeErrors converts the errors of strict YAML decoding (e.g. unknown keys) to ConfigErrors
+func typeErrors(err *yaml.TypeError) ConfigErrors {
+	errs := ConfigErrors{}
+	for _, msg := range err.Errors {
+		if m := yamlErrorRegexp.FindStringSubmatch(msg); m != nil {
+			line, _ := strconv.Atoi(m[1])
+			errs = append(errs, ConfigError{Line: line, Msg: m[2]})
+			continue
+		}
+		errs = append(errs, ConfigError{Msg: msg})
+	}
+	return errs
+}
+
+// validateQuotaConfig checks the resolved jobs of qcl, root is the parsed YAML document of file used to report line numbers.
+// The values (regions, role ARNs, account ids...) are checked against the configuration schema by validateSchema.
+// seen holds the jobs of the files already validated to report duplicates across files.
+func validateQuotaConfig(qcl *QuotaConfig, root *yaml.Node, file string, seen map[string]jobPosition) ConfigErrors {
+	errs := ConfigErrors{}
+	for k, config := range qcl.RelabelConfigs {
+		validateRelabelConfig(config, lineOf(root, "relabelConfigs", k), &errs)
+	}
+	for i, job := range qcl.Jobs {
+		line := func(path ...interface{}) int {
+			return lineOf(root, append([]interface{}{"jobs", i}, path...)...)
+		}
+		if job.ServiceCode == "" {
+			errs = append(errs, ConfigError{Line: line(), Msg: "serviceCode is required"})
+		}
+		if len(job.Regions) == 0 {
+			errs = append(errs, ConfigError{Line: line("regions"), Msg: fmt.Sprintf("job %q has no regions", job.ServiceCode)})
+		}
+		roles := []string{job.Role}
+		if job.Organization != nil {
+			roles = validateOrganization(job, line, &errs)
+		} else if len(job.Accounts) > 0 {
+			roles = validateAccounts(job, line, &errs)
+		} else if isRoleTemplate(job.Role) {
+			errs = append(errs, ConfigError{Line: line("role"), Msg: fmt.Sprintf("role template %q requires accounts", job.Role)})
+		}
+		validateAssumeRole(job, line, &errs)
+		validateLabels(job.Labels, line, &errs, "labels")
+		validateMetricNames(job, line, &errs)
+		validateUsage(job.Usage, job.ServiceCode, line, &errs)
+		for k, config := range job.RelabelConfigs {
+			validateRelabelConfig(config, line("relabelConfigs", k), &errs)
+		}
+		if job.Endpoints != nil {
+			for _, key := range []string{"servicequotas", "cloudwatch", "sts"} {
+				endpoint := job.Endpoints.urls()[key]
+				if endpoint == "" {
+					continue
+				}
+				if err := validateEndpointURL(endpoint); err != nil {
+					errs = append(errs, ConfigError{Line: line("endpoints", key), Msg: fmt.Sprintf("invalid %s endpoint %q: %s", key, endpoint, err)})
+				}
+			}
+		}
+		validatePatterns(job, line, &errs)
+		if _, err := compileQuotaFilters(job.Include); err != nil {
+			errs = append(errs, ConfigError{Line: line("include"), Msg: fmt.Sprintf("invalid include rule: %s", err)})
+		}
+		if _, err := compileQuotaFilters(job.Exclude); err != nil {
+			errs = append(errs, ConfigError{Line: line("exclude"), Msg: fmt.Sprintf("invalid exclude rule: %s", err)})
+		}
+		for _, role := range roles {
+			for j, region := range job.Regions {
+				key := strings.Join([]string{job.ServiceCode, region, role, job.Profile}, "|")
+				if first, ok := seen[key]; ok {
+					at := fmt.Sprintf("line %d", first.line)
+					if first.file != file {
+						at = fmt.Sprintf("%s:%d", first.file, first.line)
+					}
+					msg := fmt.Sprintf("duplicate job for serviceCode %q, region %q and role %q (first defined at %s)", job.ServiceCode, region, role, at)
+					if job.Profile != "" {
+						msg = fmt.Sprintf("duplicate job for serviceCode %q, region %q, role %q and profile %q (first defined at %s)", job.ServiceCode, region, role, job.Profile, at)
+					}
+					errs = append(errs, ConfigError{Line: line("regions", j), Msg: msg})
+					continue
+				}
+				seen[key] = jobPosition{file: file, line: line("regions", j)}
+			}
+		}
+	}
+	return errs
+}
+
+// validateAccounts checks the accounts of job and returns the role rendered for every account
+func validateAccounts(job JobConfig, line func(path ...interface{}) int, errs *ConfigErrors) []string {
+	roles := []string{}
+	if job.Role == "" {
+		*errs = append(*errs, ConfigError{Line: line("accounts"), Msg: fmt.Sprintf("job %q with accounts requires a role template", job.ServiceCode)})
+		return roles
+	}
+	if !accountIDRegexp.MatchString(job.Role) {
+		// every account would assume the same role
+		*errs = append(*errs, ConfigError{Line: line("role"), Msg: fmt.Sprintf("role of job %q must contain {{.AccountID}} when accounts are listed", job.ServiceCode)})
+		return roles
+	}
+	seen := map[string]bool{}
+	for k, account := range job.Accounts {
+		if seen[account.ID] {
+			*errs = append(*errs, ConfigError{Line: line("accounts", k), Msg: fmt.Sprintf("duplicate account id %q", account.ID)})
+			continue
+		}
+		seen[account.ID] = true
+		role, err := renderRole(job.Role, account)
+		if err != nil {
+			*errs = append(*errs, ConfigError{Line: line("role"), Msg: fmt.Sprintf("invalid role template %q: %s", job.Role, err)})
+			return roles
+		}
+		if !validateRoleARN(role) {
+			*errs = append(*errs, ConfigError{Line: line("role"), Msg: fmt.Sprintf("invalid role ARN %q for account %q", role, account.ID)})
+			continue
+		}
+		roles = append(roles, role)
+	}
+	return roles
+}
+
+// validateOrganization checks the organization of job and returns the role assumed in its accounts
+func validateOrganization(job JobConfig, line func(path ...interface{}) int, errs *ConfigErrors) []string {
+	org := job.Organization
+	if len(job.Accounts) > 0 {
+		*errs = append(*errs, ConfigError{Line: line("organization"), Msg: fmt.Sprintf("job %q cannot have both accounts and organization", job.ServiceCode)})
+	}
+	if org.RoleName != "" {
+		if strings.ContainsAny(org.RoleName, ":{}") {
+			*errs = append(*errs, ConfigError{Line: line("organization", "roleName"), Msg: fmt.Sprintf("invalid role name %q", org.RoleName)})
+		}
+		return []string{"role/" + org.RoleName}
+	}
+	if !isRoleTemplate(job.Role) {
+		*errs = append(*errs, ConfigError{Line: line("organization"), Msg: fmt.Sprintf("job %q with organization requires roleName or a role template", job.ServiceCode)})
+		return []string{}
+	}
+	role, err := renderRole(job.Role, AccountConfig{ID: "000000000000"})
+	if err != nil {
+		*errs = append(*errs, ConfigError{Line: line("role"), Msg: fmt.Sprintf("invalid role template %q: %s", job.Role, err)})
+	} else if !validateRoleARN(role) {
+		*errs = append(*errs, ConfigError{Line: line("role"), Msg: fmt.Sprintf("invalid role ARN %q", role)})
+	}
+	return []string{job.Role}
+}
+
+// validateAssumeRole checks the STS options used to assume the roles of job
+func validateAssumeRole(job JobConfig, line func(path ...interface{}) int, errs *ConfigErrors) {
+	hasRole := job.Role != "" || (job.Organization != nil && (job.Organization.Role != "" || job.Organization.RoleName != ""))
+	if !hasRole && (len(job.RoleChain) > 0 || job.ExternalID != "" || job.SessionName != "" || job.SessionDuration != 0 || job.SourceIdentity != "") {
+		*errs = append(*errs, ConfigError{Line: line(), Msg: fmt.Sprintf("job %q sets assume role options without a role", job.ServiceCode)})
+	}
+	if job.SessionDuration != 0 && (job.SessionDuration < minSessionDuration || job.SessionDuration > maxSessionDuration) {
+		*errs = append(*errs, ConfigError{Line: line("sessionDuration"), Msg: fmt.Sprintf("invalid sessionDuration %s, must be between %s and %s", job.SessionDuration, minSessionDuration, maxSessionDuration)})
+	} else if len(job.RoleChain) > 0 && job.SessionDuration > maxChainedSessionDuration {
+		*errs = append(*errs, ConfigError{Line: line("sessionDuration"), Msg: fmt.Sprintf("invalid sessionDuration %s with roleChain, chained sessions are limited to %s", job.SessionDuration, maxChainedSessionDuration)})
+	}
+}
+
+// validateLabels checks the static labels at path are valid label names and do not override the built-in labels
+func validateLabels(labels map[string]string, line func(path ...interface{}) int, errs *ConfigErrors, path ...interface{}) {
+	for _, name := range sortedKeys(labels) {
+		labelPath := append(append([]interface{}{}, path...), name)
+		switch {
+		case !model.LabelName(name).IsValid() || strings.HasPrefix(name, model.ReservedLabelPrefix):
+			*errs = append(*errs, ConfigError{Line: line(labelPath...), Msg: fmt.Sprintf("invalid label name %q", name)})
+		case contains(builtinLabels, name):
+			*errs = append(*errs, ConfigError{Line: line(labelPath...), Msg: fmt.Sprintf("label %q collides with a built-in label", name)})
+		}
+	}
+}
+
+// validateMetricNames checks the keys and extra labels of the fixed metric names of job, the names are checked by validateSchema
+func validateMetricNames(job JobConfig, line func(path ...interface{}) int, errs *ConfigErrors) {
+	for _, key := range sortedKeys(job.MetricNames) {
+		if !validQuotaKey(key) {
+			*errs = append(*errs, ConfigError{Line: line("metricNames", key), Msg: fmt.Sprintf("invalid metricNames key %q, must be serviceCode/quotaCode", key)})
+		}
+		if job.MetricNames[key].Name == "" {
+			*errs = append(*errs, ConfigError{Line: line("metricNames", key), Msg: fmt.Sprintf("metric name of %q is required", key)})
+		}
+		validateLabels(job.MetricNames[key].Labels, line, errs, "metricNames", key, "labels")
+	}
+}
+
+// validQuotaKey returns true if key is serviceCode/quotaCode
+func validQuotaKey(key string) bool {
+	serviceCode, quotaCode, ok := strings.Cut(key, "/")
+	return ok && serviceCode != "" && quotaCode != "" && !strings.Contains(quotaCode, "/")
+}
+
+// validatePatterns checks the regular expressions (/regex/) of the service codes and regions of a job,
+// the quota codes are checked with the include and exclude rules
+func validatePatterns(job JobConfig, line func(path ...interface{}) int, errs *ConfigErrors) {
+	if _, err := compilePattern(job.ServiceCode); err != nil {
+		*errs = append(*errs, ConfigError{Line: line("serviceCode"), Msg: err.Error()})
+	}
+	for i, text := range job.ExcludeServiceCodes {
+		if _, err := compilePattern(text); err != nil {
+			*errs = append(*errs, ConfigError{Line: line("excludeServiceCodes", i), Msg: err.Error()})
+		}
+	}
+	for i, text := range job.ExcludeRegions {
+		if _, err := compilePattern(text); err != nil {
+			*errs = append(*errs, ConfigError{Line: line("excludeRegions", i), Msg: err.Error()})
+		}
+	}
+}
+
+// validateUsage checks the CloudWatch options of the usage, the statistics are checked by validateSchema.
+// The options are resolved as they are for the quotas of serviceCode, e.g. the period of the job with the 75m lookback of rds.
+func validateUsage(usage *UsageConfig, serviceCode string, line func(path ...interface{}) int, errs *ConfigErrors) {
+	if usage == nil {
+		return
+	}
+	check := func(options UsageOptions, path ...interface{}) bool {
+		valid := true
+		if options.Lookback < 0 || options.Lookback%time.Minute != 0 {
+			*errs = append(*errs, ConfigError{Line: line(append(path, "lookback")...), Msg: fmt.Sprintf("invalid usage lookback %s, must be a positive multiple of 1m", options.Lookback)})
+			valid = false
+		}
+		if options.Period < 0 || options.Period%time.Minute != 0 {
+			*errs = append(*errs, ConfigError{Line: line(append(path, "period")...), Msg: fmt.Sprintf("invalid usage period %s, must be a multiple of 1m", options.Period)})
+			valid = false
+		}
+		return valid
+	}
+	// checkQuery reports a period longer than the lookback once, at the options setting one of them
+	checkQuery := func(query usageQuery, of string, path ...interface{}) bool {
+		if query.period > query.lookback {
+			*errs = append(*errs, ConfigError{Line: line(append(path, "period")...), Msg: fmt.Sprintf("usage period %s%s is longer than the lookback %s", query.period, of, query.lookback)})
+			return false
+		}
+		return true
+	}
+	sets := func(options UsageOptions) bool { return options.Lookback > 0 || options.Period > 0 }
+
+	p, _ := compilePattern(serviceCode) // invalid patterns are reported by validatePatterns
+	if check(usage.UsageOptions, "usage") && checkQuery(usage.resolve("", ""), "", "usage") {
+		// the default lookback of a service scraped by the job replaces the lookback of the job
+		for _, service := range sortedKeys(defaultServiceUsageLookback) {
+			if !sets(usage.Services[service]) && (serviceCode == service || isPattern(serviceCode) && p != nil && p.match(service)) {
+				checkQuery(usage.resolve(service, ""), " of "+service, "usage")
+			}
+		}
+	}
+	for _, service := range sortedKeys(usage.Services) {
+		if options := usage.Services[service]; check(options, "usage", "services", service) && sets(options) {
+			checkQuery(usage.resolve(service, ""), "", "usage", "services", service)
+		}
+	}
+	for _, key := range sortedKeys(usage.Quotas) {
+		if !validQuotaKey(key) {
+			*errs = append(*errs, ConfigError{Line: line("usage", "quotas", key), Msg: fmt.Sprintf("invalid usage quotas key %q, must be serviceCode/quotaCode", key)})
+		}
+		service, quotaCode, _ := strings.Cut(key, "/")
+		if options := usage.Quotas[key]; check(options, "usage", "quotas", key) && sets(options) && validQuotaKey(key) {
+			checkQuery(usage.resolve(service, quotaCode), "", "usage", "quotas", key)
+		}
+	}
+}
+
+// sortedKeys returns the keys of m in order, to report errors in a stable order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// validateRelabelConfig checks a relabeling rule, unknown actions are reported by validateSchema
+func validateRelabelConfig(config RelabelConfig, line int, errs *ConfigErrors) {
+	if _, err := compileRelabelConfig(config); err != nil && !errors.Is(err, errUnknownRelabelAction) {
+		*errs = append(*errs, ConfigError{Line: line, Msg: fmt.Sprintf("invalid relabel config: %s", err)})
+	}
+}
+
+// lineOf returns the line of the node at path (mapping keys and sequence indexes) in root.
+// The line of the deepest existing node is returned when the path does not exist (e.g. inherited fields).
+func lineOf(root *yaml.Node, path ...interface{}) int {
+	node := root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	line := node.Line
+	for _, p := range path {
+		var next *yaml.Node
+		switch key := p.(type) {
+		case string:
+			if node.Kind != yaml.MappingNode {
+				return line
+			}
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == key {
+					next = node.Content[i+1]
+					line = node.Content[i].Line
+					break
+				}
+			}
+		case int:
+			if node.Kind != yaml.SequenceNode || key >= len(node.Content) {
+				return line
+			}
+			next = node.Content[key]
+			line = next.Line
+		}
+		if next == nil {
+			return line
+		}
+		node = next
+	}
+	return line
+}
@@ -0,0 +1,367 @@
+package pkg
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func Test_parseQuotaConfig_Validation(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   ConfigErrors
+	}{
+		{
+			name: "valid config",
+			config: `defaults:
+  regions: [us-east-1]
+jobs:
+  - serviceCode: lambda
+  - serviceCode: ec2
+    regions: ["*"]
+    role: arn:aws:iam::012345678901:role/aws-quota-exporter
+`,
+			want: nil,
+		},
+		{
+			name: "unknown keys",
+			config: `jobs:
+  - serviceCode: lambda
+    region:
+      - us-west-2
+  - servicecode: ec2
+    regions: [us-west-2]
+`,
+			want: ConfigErrors{
+				{Line: 2, Msg: `job "lambda" has no regions`},
+				{Line: 3, Msg: "field region not found in type pkg.JobConfig"},
+				{Line: 5, Msg: "field servicecode not found in type pkg.JobConfig"},
+				{Line: 5, Msg: "serviceCode is required"},
+			},
+		},
+		{
+			name: "invalid regions and role",
+			config: `jobs:
+  - serviceCode: ec2
+    regions:
+      - us-west-2
+      - useast1
+    role: arn:aws:iam::012345678901:user/aws-quota-exporter
+`,
+			want: ConfigErrors{
+				{Line: 5, Msg: `invalid region "useast1", must match ^(\*|[a-z]{2}(-[a-z]+)?-[a-z]+-[0-9]+)$`},
+				{Line: 6, Msg: `invalid role ARN "arn:aws:iam::012345678901:user/aws-quota-exporter", must match ^arn:[a-z-]+:iam::[^:]*:role/.+$`},
+			},
+		},
+		{
+			name: "duplicate jobs",
+			config: `defaults:
+  regions: [us-west-2]
+jobs:
+  - serviceCode: ec2
+  - serviceCode: ec2
+    regions: [us-east-1, us-west-2]
+  - serviceCode: ec2
+    regions: [us-west-2]
+    role: arn:aws:iam::012345678901:role/aws-quota-exporter
+  - serviceCode: ec2
+    profile: dev
+  - serviceCode: ec2
+    profile: dev
+`,
+			want: ConfigErrors{
+				{Line: 6, Msg: `duplicate job for serviceCode "ec2", region "us-west-2" and role "" (first defined at line 4)`},
+				{Line: 12, Msg: `duplicate job for serviceCode "ec2", region "us-west-2", role "" and profile "dev" (first defined at line 10)`},
+			},
+		},
+		{
+			name: "accounts",
+			config: `jobs:
+  - serviceCode: ec2
+    regions: [us-west-2]
+    role: arn:aws:iam::{{.AccountID}}:role/quota-reader
+    accounts:
+      - id: "111111111111"
+      - id: "2222"
+      - id: "111111111111"
+  - serviceCode: lambda
+    regions: [us-west-2]
+    accounts:
+      - id: "111111111111"
+  - serviceCode: rds
+    regions: [us-west-2]
+    role: arn:aws:iam::{{.AccountID}}:role/quota-reader
+  - serviceCode: s3
+    regions: [us-west-2]
+    role: arn:aws:iam::111111111111:role/quota-reader
+    accounts:
+      - id: "111111111111"
+      - id: "222222222222"
+  - serviceCode: ebs
+    regions: [us-west-2]
+    role: arn:aws:iam::111111111111:role/{{.AccountName}}
+    accounts:
+      - id: "111111111111"
+        name: reader
+`,
+			want: ConfigErrors{
+				{Line: 7, Msg: `invalid account id "2222", must match ^[0-9]{12}$`},
+				{Line: 8, Msg: `duplicate account id "111111111111"`},
+				{Line: 11, Msg: `job "lambda" with accounts requires a role template`},
+				{Line: 15, Msg: `role template "arn:aws:iam::{{.AccountID}}:role/quota-reader" requires accounts`},
+				{Line: 18, Msg: `role of job "s3" must contain {{.AccountID}} when accounts are listed`},
+				{Line: 24, Msg: `role of job "ebs" must contain {{.AccountID}} when accounts are listed`},
+			},
+		},
+		{
+			name: "organization",
+			config: `jobs:
+  - serviceCode: ec2
+    regions: [us-west-2]
+    organization:
+      roleName: quota-reader
+      status: [ACTIVE, CLOSED]
+      excludeAccounts: ["1234"]
+  - serviceCode: lambda
+    regions: [us-west-2]
+    role: arn:aws:iam::{{.AccountID}}:role/quota-reader
+    organization:
+      role: arn:aws:iam::999999999999:user/admin
+  - serviceCode: rds
+    regions: [us-west-2]
+    organization:
+      ous: [ou-abcd-12345678]
+`,
+			want: ConfigErrors{
+				{Line: 6, Msg: `invalid account status "CLOSED", must be one of ACTIVE, SUSPENDED, PENDING_CLOSURE`},
+				{Line: 7, Msg: `invalid account id "1234", must match ^[0-9]{12}$`},
+				{Line: 12, Msg: `invalid organization role ARN "arn:aws:iam::999999999999:user/admin", must match ^arn:[a-z-]+:iam::[^:]*:role/.+$`},
+				{Line: 15, Msg: `job "rds" with organization requires roleName or a role template`},
+			},
+		},
+		{
+			name: "assume role options",
+			config: `jobs:
+  - serviceCode: ec2
+    regions: [us-west-2]
+    role: arn:aws:iam::222222222222:role/spoke
+    roleChain:
+      - arn:aws:iam::111111111111:role/hub
+      - hub
+    externalId: "a b"
+    sessionName: quota exporter
+    sessionDuration: 13h
+    sourceIdentity: exporter
+  - serviceCode: lambda
+    regions: [us-west-2]
+    externalId: secret
+  - serviceCode: rds
+    regions: [us-west-2]
+    role: arn:aws:iam::222222222222:role/spoke
+    roleChain: [arn:aws:iam::111111111111:role/hub]
+    sessionDuration: 2h
+`,
+			want: ConfigErrors{
+				{Line: 7, Msg: `invalid role ARN "hub", must match ^arn:[a-z-]+:iam::[^:]*:role/.+$`},
+				{Line: 8, Msg: `invalid externalId, must match ^[\w+=,.@:/-]+$`},
+				{Line: 9, Msg: `invalid sessionName "quota exporter", must match ^[\w+=,.@-]{2,64}$`},
+				{Line: 10, Msg: `invalid sessionDuration 13h0m0s, must be between 15m0s and 12h0m0s`},
+				{Line: 12, Msg: `job "lambda" sets assume role options without a role`},
+				{Line: 19, Msg: `invalid sessionDuration 2h0m0s with roleChain, chained sessions are limited to 1h0m0s`},
+			},
+		},
+		{
+			name: "endpoints",
+			config: `endpoints:
+  sts: http://localhost:4566
+jobs:
+  - serviceCode: ec2
+    regions: [us-west-2]
+    endpoints:
+      servicequotas: localhost:4566
+      cloudwatch: https://monitoring.us-west-2.amazonaws.com
+      fips: true
+  - serviceCode: lambda
+    regions: [us-west-2]
+    endpoints:
+      cloudwatch: "http://%zz"
+  # a shared endpoint (LocalStack, a proxy) serves every region of the job
+  - serviceCode: ec2
+    regions: [us-east-1, eu-west-1]
+    endpoints:
+      servicequotas: http://localhost:4566
+  - serviceCode: ebs
+    regions: ["*"]
+    endpoints:
+      cloudwatch: http://localhost:4566
+`,
+			want: ConfigErrors{
+				{Line: 7, Msg: `invalid servicequotas endpoint "localhost:4566": must be an http or https URL`},
+				{Line: 13, Msg: `invalid cloudwatch endpoint "http://%zz": parse "http://%zz": invalid URL escape "%zz"`},
+			},
+		},
+		{
+			name: "labels",
+			config: `defaults:
+  regions: [us-west-2]
+  labels:
+    env: prod
+jobs:
+  - serviceCode: ec2
+    labels:
+      team: payments
+      region: eu
+      __name__: quota
+      app-name: aqe
+`,
+			want: ConfigErrors{
+				{Line: 9, Msg: `label "region" collides with a built-in label`},
+				{Line: 10, Msg: `invalid label name "__name__"`},
+				{Line: 11, Msg: `invalid label name "app-name"`},
+			},
+		},
+		{
+			name: "metric names",
+			config: `defaults:
+  regions: [us-west-2]
+jobs:
+  - serviceCode: ec2
+    metricNames:
+      ec2/L-1216C47A:
+        name: aws_quota_ec2_standard_instances
+        labels:
+          family: standard
+      L-34B43A08:
+        name: aws_quota_ec2_spot
+      ec2/L-0263D0A3:
+        name: aws-quota-ec2-eips
+      ec2/L-74FC7D96:
+        name: aws_quota_ec2_f_instances
+        labels:
+          type: f
+`,
+			want: ConfigErrors{
+				{Line: 10, Msg: `invalid metricNames key "L-34B43A08", must be serviceCode/quotaCode`},
+				{Line: 13, Msg: `invalid metric name "aws-quota-ec2-eips", must match ^[a-zA-Z_:][a-zA-Z0-9_:]*$`},
+				{Line: 17, Msg: `label "type" collides with a built-in label`},
+			},
+		},
+		{
+			name: "patterns",
+			config: `defaults:
+  regions: [us-west-2]
+jobs:
+  - serviceCode: /ec2(/
+    excludeServiceCodes: [ebs, "/[/"]
+  - serviceCode: ec2
+    regions: ["*"]
+    excludeRegions: [/+/]
+    include:
+      - quotaCode: /L-(/
+`,
+			want: ConfigErrors{
+				{Line: 4, Msg: `invalid regular expression "/ec2(/": error parsing regexp: missing closing ): ` + "`ec2(`"},
+				{Line: 5, Msg: `invalid regular expression "/[/": error parsing regexp: missing closing ]: ` + "`[`"},
+				{Line: 8, Msg: `invalid regular expression "/+/": error parsing regexp: missing argument to repetition operator: ` + "`+`"},
+				{Line: 9, Msg: `invalid include rule: invalid regular expression "/L-(/": error parsing regexp: missing closing ): ` + "`L-(`"},
+			},
+		},
+		{
+			name: "usage",
+			config: `defaults:
+  regions: [us-west-2]
+jobs:
+  - serviceCode: ec2
+    usage:
+      lookback: 10m
+      period: 15m
+      statistic: Median
+      services:
+        ec2:
+          period: 90s
+      quotas:
+        L-1216C47A:
+          lookback: -5m
+  - serviceCode: /rds|docdb/
+    usage:
+      lookback: 2h
+      period: 90m
+  - serviceCode: lambda
+    usage:
+      period: 10m
+      services:
+        lambda:
+          lookback: 90s
+      quotas:
+        lambda/L-B99A9384:
+          lookback: 5m
+`,
+			want: ConfigErrors{
+				{Line: 7, Msg: "usage period 15m0s is longer than the lookback 10m0s"},
+				{Line: 8, Msg: `invalid usage statistic "Median", must be one of Maximum, Minimum, Average, Sum, SampleCount`},
+				{Line: 11, Msg: "invalid usage period 1m30s, must be a multiple of 1m"},
+				{Line: 13, Msg: `invalid usage quotas key "L-1216C47A", must be serviceCode/quotaCode`},
+				{Line: 14, Msg: "invalid usage lookback -5m0s, must be a positive multiple of 1m"},
+				{Line: 18, Msg: "usage period 1h30m0s of rds is longer than the lookback 1h15m0s"},
+				{Line: 24, Msg: "invalid usage lookback 1m30s, must be a positive multiple of 1m"},
+				{Line: 26, Msg: "usage period 10m0s is longer than the lookback 5m0s"},
+			},
+		},
+		{
+			name: "relabel configs",
+			config: `relabelConfigs:
+  - action: labeldrop
+    regex: "("
+jobs:
+  - serviceCode: ec2
+    regions: [us-west-2]
+    relabelConfigs:
+      - action: hashmod
+        targetLabel: shard
+      - action: delete
+`,
+			want: ConfigErrors{
+				{Line: 2, Msg: "invalid relabel config: error parsing regexp: missing closing ): `^(?:()$`"},
+				{Line: 8, Msg: "invalid relabel config: hashmod requires a modulus"},
+				{Line: 10, Msg: `invalid action "delete", must be one of replace, keep, drop, labeldrop, labelkeep, labelmap, hashmod`},
+			},
+		},
+		{
+			name: "invalid filters and listMerge",
+			config: `jobs:
+  - serviceCode: ec2
+    regions: [us-west-2]
+    listMerge: append
+    exclude:
+      - quotaName: "("
+`,
+			want: ConfigErrors{
+				{Line: 4, Msg: `invalid listMerge "append", must be one of replace, merge`},
+				{Line: 5, Msg: "invalid exclude rule: error parsing regexp: missing closing ): `(`"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseQuotaConfig([]byte(tt.config))
+			var got ConfigErrors
+			if err != nil && !errors.As(err, &got) {
+				t.Fatalf("parseQuotaConfig() error = %v, want ConfigErrors", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseQuotaConfig() errors = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewQuotaConfig_Examples(t *testing.T) {
+	for _, configFile := range []string{"../example/config.yml", "../docker/aws_quota_exporter/config.yml"} {
+		t.Run(configFile, func(t *testing.T) {
+			if _, err := NewQuotaConfig(configFile); err != nil {
+				t.Errorf("NewQuotaConfig() error = %v", err)
+			}
+		})
+	}
+}